@@ -18,13 +18,12 @@ package main
 
 import (
 	"context"
-	"encoding/json"
 	"flag"
 	"fmt"
 	"io"
-	"net/http"
 	"os"
 	"strings"
+	"time"
 
 	// Import all Kubernetes client auth plugins (e.g. Azure, GCP, OIDC, etc.)
 	// to ensure that exec-entrypoint and run can make use of them.
@@ -34,16 +33,20 @@ import (
 	v1 "k8s.io/api/core/v1"
 	_ "k8s.io/client-go/plugin/pkg/client/auth"
 
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
 	"k8s.io/apimachinery/pkg/runtime"
 	utilruntime "k8s.io/apimachinery/pkg/util/runtime"
 	clientgoscheme "k8s.io/client-go/kubernetes/scheme"
 	ctrl "sigs.k8s.io/controller-runtime"
+	"sigs.k8s.io/controller-runtime/pkg/cache"
+	"sigs.k8s.io/controller-runtime/pkg/client"
 	"sigs.k8s.io/controller-runtime/pkg/healthz"
 	"sigs.k8s.io/controller-runtime/pkg/log/zap"
 	"sigs.k8s.io/controller-runtime/pkg/manager"
 	"sigs.k8s.io/controller-runtime/pkg/metrics/server"
 
 	"github.com/f5devcentral/bigip-kubernetes-gateway/internal/controllers"
+	"github.com/f5devcentral/bigip-kubernetes-gateway/internal/k8s"
 	"github.com/f5devcentral/bigip-kubernetes-gateway/internal/pkg"
 	"github.com/f5devcentral/bigip-kubernetes-gateway/internal/webhooks"
 	f5_bigip "github.com/f5devcentral/f5-bigip-rest-go/bigip"
@@ -56,11 +59,27 @@ import (
 )
 
 type CmdFlags struct {
-	CredsDir     string
-	ConfDir      string
-	Validates    string
-	DeployMethod string
-	LogLevel     string
+	CredsDir               string
+	ConfDir                string
+	Validates              string
+	DeployMethod           string
+	LogLevel               string
+	CNIType                string
+	DriftCheck             time.Duration
+	SelfHeal               bool
+	AS3Timeout             time.Duration
+	MemberFastPath         bool
+	AppliedState           string
+	GCInterval             time.Duration
+	TenantPrefix           string
+	ClusterName            string
+	InstanceID             string
+	DryRun                 string
+	RuntimeToken           string
+	WatchNamespaces        string
+	WatchNamespaceSelector string
+	CoalesceInterval       time.Duration
+	CoalesceMaxLatency     time.Duration
 }
 
 var (
@@ -101,6 +120,38 @@ func main() {
 	flag.StringVar(&cmdflags.Validates, "validates", "", fmt.Sprintf("The items to validate synchronizingly, on operations "+
 		"concating multiple values with ',', valid values: %s", strings.Join(webhooks.SupportedValidatingKeys(), ",")))
 	flag.StringVar(&cmdflags.DeployMethod, "deploy-method", "as3", "The deploy method to BIG-IP for the gateway resources, valid values: as3 rest")
+	flag.StringVar(&cmdflags.CNIType, "cni-type", "", fmt.Sprintf("The CNI type of the cluster, detected from nodes if not set, "+
+		"valid values: %s", strings.Join(k8s.SupportedCNITypes, ",")))
+
+	flag.DurationVar(&cmdflags.DriftCheck, "drift-check-interval", 5*time.Minute, "The interval to check if the resources on BIG-IP drift "+
+		"from the desired state, 0 to disable the check.")
+	flag.BoolVar(&cmdflags.SelfHeal, "self-heal", false, "Re-apply the tenants drifted on BIG-IP.")
+	flag.StringVar(&cmdflags.AppliedState, "applied-state-configmap", "kube-system/bigip-kubernetes-gateway-applied", "The ConfigMap "+
+		"<namespace>/<name> to persist the tenants and tunnel fdb records applied to BIG-IPs across restarts, empty to disable.")
+	flag.DurationVar(&cmdflags.GCInterval, "gc-interval", 0, "The interval to remove the orphan tenants "+
+		"created by the controller from BIG-IPs, 0 to disable. Requires --cluster-name or --instance-id, "+
+		"the tenants of other controllers sharing the BIG-IPs are not told apart otherwise.")
+	flag.StringVar(&cmdflags.TenantPrefix, "tenant-prefix", "", "The prefix of the AS3 tenant names generated from gateway classes and namespaces.")
+	flag.StringVar(&cmdflags.ClusterName, "cluster-name", "", "The name of the cluster, stamped to the generated AS3 tenants as the owner and woven into tenant, static arp and route names. Required when several clusters share one BIG-IP.")
+	flag.StringVar(&cmdflags.InstanceID, "instance-id", "", "The ID of this controller instance, stamped to the generated AS3 tenants "+
+		"as the owner, default to --controller-name.")
+	flag.StringVar(&cmdflags.DryRun, "dry-run", "", "Render the AS3 declarations without deploying to BIG-IPs, valid values: "+
+		"log, dir:<directory>, configmap:<namespace>/<name>. The BIG-IPs are not connected, network resources, drift check, "+
+		"garbage collection and applied state are disabled in this mode.")
+	flag.StringVar(&cmdflags.RuntimeToken, "runtime-token-file", "", "The file containing the bearer token to access the /runtime/ "+
+		"debug endpoints on the metrics address, the endpoints are disabled if not set.")
+	flag.StringVar(&cmdflags.WatchNamespaces, "watch-namespaces", "", "The namespaces to watch the gateways, routes and backends in, "+
+		"concating multiple values with ',', default to all namespaces. Cluster-wide read of nodes, namespaces and gatewayclasses is still required.")
+	flag.StringVar(&cmdflags.WatchNamespaceSelector, "watch-namespace-selector", "", "The label selector of the namespaces to watch, "+
+		"e.g. 'bigip-gateway=enabled', instead of --watch-namespaces. Resolved at startup, restart the controller after relabeling namespaces.")
+	flag.DurationVar(&cmdflags.CoalesceInterval, "backend-coalesce-interval", time.Second, "The quiet interval to batch the Endpoints "+
+		"and Service changes of a namespace into one deployment, 0 to deploy each change immediately.")
+	flag.DurationVar(&cmdflags.CoalesceMaxLatency, "backend-coalesce-max-latency", 10*time.Second, "The max time to delay the "+
+		"deployment of the batched Endpoints and Service changes, e.g. during a rolling update.")
+	flag.DurationVar(&cmdflags.AS3Timeout, "as3-task-timeout", 10*time.Minute, "The max time to wait for an async AS3 task to finish.")
+	flag.BoolVar(&cmdflags.MemberFastPath, "pool-member-fast-path", false, "Update the pool members over iControl REST instead of "+
+		"deploying the whole tenant via AS3, when nothing but pool members changes. The tenant is re-deployed via AS3 "+
+		"a minute after the member updates stop, to keep the declaration of AS3 consistent.")
 
 	opts := zap.Options{
 		Development: true,
@@ -115,47 +166,111 @@ func main() {
 		webhooks.TurnOnValidatingFor(strings.Split(cmdflags.Validates, ","))
 	}
 
+	if err := k8s.ValidCNIType(cmdflags.CNIType); err != nil {
+		setupLog.Error(err, "--cni-type fault")
+		os.Exit(1)
+	} else {
+		k8s.CNIType = cmdflags.CNIType
+	}
+
+	if cmdflags.GCInterval > 0 && cmdflags.ClusterName == "" && cmdflags.InstanceID == "" {
+		setupLog.Error(fmt.Errorf("neither --cluster-name nor --instance-id is set"), "--gc-interval fault")
+		os.Exit(1)
+	}
+
 	pkg.ActiveSIGs.ControllerName = controllerName
-	if err := setupBIGIPs(cmdflags.CredsDir, cmdflags.ConfDir); err != nil {
+	if err := setupBIGIPs(cmdflags.CredsDir, cmdflags.ConfDir, cmdflags.DryRun != ""); err != nil {
 		setupLog.Error(err, "failed to setup BIG-IPs")
 		os.Exit(1)
 	}
 	pkg.LogLevel = cmdflags.LogLevel
+	pkg.AS3TaskTimeout = cmdflags.AS3Timeout
+	pkg.MemberFastPath = cmdflags.MemberFastPath
+	pkg.TenantPrefix, pkg.ClusterName, pkg.InstanceID = cmdflags.TenantPrefix, cmdflags.ClusterName, cmdflags.InstanceID
+	if pkg.InstanceID == "" {
+		pkg.InstanceID = controllerName
+	}
 	pkg.PendingDeploys, pkg.DoneDeploys = utils.NewDeployQueue(), utils.NewDeployQueue()
-	go pkg.AS3Deployer(stopCh, pkg.BIGIPs)
 	go pkg.RespHandler(stopCh)
+	pkg.SetupBackendCoalescer(cmdflags.CoalesceInterval, cmdflags.CoalesceMaxLatency)
+	go pkg.BackendCoalescer(stopCh)
 
 	ctrl.SetLogger(zap.New(zap.UseFlagOptions(&opts)))
-	mgr, err := ctrl.NewManager(ctrl.GetConfigOrDie(), ctrl.Options{
+	config := ctrl.GetConfigOrDie()
+	if cmdflags.WatchNamespaces != "" || cmdflags.WatchNamespaceSelector != "" {
+		reader, err := client.New(config, client.Options{Scheme: scheme})
+		if err != nil {
+			setupLog.Error(err, "unable to create client")
+			os.Exit(1)
+		}
+		if err := pkg.SetupWatchNamespaces(context.TODO(), reader, cmdflags.WatchNamespaces, cmdflags.WatchNamespaceSelector); err != nil {
+			setupLog.Error(err, "--watch-namespaces or --watch-namespace-selector fault")
+			os.Exit(1)
+		}
+		setupLog.Info(fmt.Sprintf("watching namespaces: %s", strings.Join(pkg.WatchedNamespaces(), ",")))
+	}
+	mgr, err := ctrl.NewManager(config, ctrl.Options{
 		Scheme:                 scheme,
-		Metrics:                server.Options{BindAddress: metricsAddr},
+		Metrics:                server.Options{BindAddress: metricsAddr, ExtraHandlers: runtimeHandlers(cmdflags.RuntimeToken)},
 		HealthProbeBindAddress: probeAddr,
 		LeaderElection:         enableLeaderElection,
 		LeaderElectionID:       "303cfed9.f5.com",
+		// only the kubernetes.io/tls secrets are watched, without data, in the watched namespaces.
+		Cache: cache.Options{
+			DefaultNamespaces: pkg.NamespaceCacheOptions(),
+			ByObject: map[client.Object]cache.ByObject{
+				&v1.Secret{}: pkg.SecretCacheOptions(),
+			},
+		},
 		// LeaderElectionReleaseOnCancel defines if the leader should step down voluntarily
 		// when the Manager ends. This requires the binary to immediately end when the
 		// Manager is stopped, otherwise, this setting is unsafe. Setting this significantly
 		// speeds up voluntary leader transitions as the new leader don't have to wait
 		// LeaseDuration time first.
 		//
-		// In the default scaffold provided, the program ends immediately after
-		// the manager stops, so would be fine to enable this option. However,
-		// if you are doing or is intended to do any operation such as perform cleanups
-		// after the manager stops then its usage might be unsafe.
-		// LeaderElectionReleaseOnCancel: true,
+		// It's safe here: all BIG-IP writes run in the leader tasks, which the manager waits
+		// for before releasing the lease, and the program ends right after the manager stops.
+		LeaderElectionReleaseOnCancel: true,
 	})
 	if err != nil {
 		setupLog.Error(err, "unable to start manager: "+err.Error())
 		os.Exit(1)
 	}
 
+	if cmdflags.DryRun != "" {
+		if err := pkg.SetupDryRun(cmdflags.DryRun, mgr.GetAPIReader(), mgr.GetClient()); err != nil {
+			setupLog.Error(err, "--dry-run fault")
+			os.Exit(1)
+		}
+	} else if cmdflags.AppliedState != "" {
+		nn := strings.Split(cmdflags.AppliedState, "/")
+		if len(nn) != 2 {
+			setupLog.Error(fmt.Errorf("invalid format: %s", cmdflags.AppliedState), "--applied-state-configmap fault")
+			os.Exit(1)
+		}
+		pkg.SetupAppliedStore(mgr.GetAPIReader(), mgr.GetClient(), nn[0], nn[1])
+	}
+	// only the leader syncs the resources and writes to BIG-IPs.
+	leaderTasks := &pkg.LeaderTasks{}
+	leaderTasks.Go(func(chan struct{}) { pkg.ActiveSIGs.SyncAllResources(mgr) })
+	leaderTasks.Go(func(stopCh chan struct{}) { pkg.AS3Deployer(stopCh, pkg.BIGIPs) })
+	if !pkg.IsDryRun() {
+		leaderTasks.Go(func(stopCh chan struct{}) { pkg.NetDeployer(stopCh, pkg.BIGIPs, pkg.BIPConfigs) })
+		leaderTasks.Go(func(stopCh chan struct{}) { pkg.DriftDetector(stopCh, cmdflags.DriftCheck, cmdflags.SelfHeal) })
+		leaderTasks.Go(func(stopCh chan struct{}) { pkg.TenantGC(stopCh, cmdflags.GCInterval) })
+	}
+	if err := mgr.Add(leaderTasks); err != nil {
+		setupLog.Error(err, "unable to add leader tasks")
+		os.Exit(1)
+	}
+
 	prometheus.MustRegister(utils.FunctionDurationTimeCostCount)
 	prometheus.MustRegister(utils.FunctionDurationTimeCostTotal)
 	prometheus.MustRegister(f5_bigip.BIGIPiControlTimeCostCount)
 	prometheus.MustRegister(f5_bigip.BIGIPiControlTimeCostTotal)
-	// TODO: use echo
-	// mgr.AddMetricsExtraHandler("/stats/", promhttp.Handler())
-	// mgr.AddMetricsExtraHandler("/runtime/", dumpRuntimeHandler())
+	prometheus.MustRegister(pkg.DriftedResources)
+	prometheus.MustRegister(pkg.BackendBatches)
+	prometheus.MustRegister(pkg.BackendSavedDeploys)
 
 	setupReconcilers(mgr)
 
@@ -168,7 +283,7 @@ func main() {
 		os.Exit(1)
 	}
 
-	go pkg.ActiveSIGs.SyncAllResources(mgr)
+	go controllers.StatusUpdater(stopCh, mgr.GetClient())
 
 	defer close(stopCh)
 	setupLog.Info("starting manager")
@@ -222,6 +337,7 @@ func setupReconcilers(mgr manager.Manager) {
 		&controllers.GatewayReconciler{
 			ObjectType: &gatewayapi.Gateway{},
 			Client:     mgr.GetClient(),
+			Reader:     mgr.GetAPIReader(),
 			// LogLevel:   cmdflags.LogLevel,
 		},
 		&controllers.HttpRouteReconciler{
@@ -237,6 +353,7 @@ func setupReconcilers(mgr manager.Manager) {
 		&controllers.SecretReconciler{
 			ObjectType: &v1.Secret{},
 			Client:     mgr.GetClient(),
+			Reader:     mgr.GetAPIReader(),
 			// LogLevel:   cmdflags.LogLevel,
 		},
 		&controllers.EndpointsReconciler{
@@ -260,12 +377,26 @@ func setupReconcilers(mgr manager.Manager) {
 			// LogLevel:   cmdflags.LogLevel,
 		},
 	)
+	// the calico IPAM blocks are watched only if calico is installed.
+	gvk := k8s.BlockAffinityGVK
+	if _, err := mgr.GetRESTMapper().RESTMapping(gvk.GroupKind(), gvk.Version); err == nil {
+		blocks := &unstructured.Unstructured{}
+		blocks.SetGroupVersionKind(gvk)
+		resources.Register(&controllers.BlockAffinityReconciler{
+			ObjectType: blocks,
+			Client:     mgr.GetClient(),
+		})
+	} else {
+		setupLog.Info(fmt.Sprintf("not watching %s: %s", gvk.Kind, err.Error()))
+	}
 	resources.StartReconcilers(mgr)
 }
 
-func setupBIGIPs(credsDir, confDir string) error {
+// setupBIGIPs connects the configured BIG-IPs, or only records their urls in dry-run mode,
+// in which the password is not needed either.
+func setupBIGIPs(credsDir, confDir string, dryRun bool) error {
 	// TODO: the filenames must be 'bigip-kubernetes-gateway-config' and 'password'
-	if err := getCredentials(&pkg.BIPPassword, credsDir); err != nil {
+	if err := getCredentials(&pkg.BIPPassword, credsDir); err != nil && !dryRun {
 		return err
 	}
 	if err := getConfigs(&pkg.BIPConfigs, confDir); err != nil {
@@ -278,6 +409,10 @@ func setupBIGIPs(credsDir, confDir string) error {
 			*c.Management.Port = 443
 		}
 		url := fmt.Sprintf("https://%s:%d", c.Management.IpAddress, *c.Management.Port)
+		if dryRun {
+			pkg.BIGIPs = append(pkg.BIGIPs, &f5_bigip.BIGIP{URL: url})
+			continue
+		}
 		username := c.Management.Username
 		bigip := f5_bigip.New(url, username, pkg.BIPPassword)
 		pkg.BIGIPs = append(pkg.BIGIPs, bigip)
@@ -288,53 +423,3 @@ func setupBIGIPs(credsDir, confDir string) error {
 		return nil
 	}
 }
-
-func dumpRuntimeHandler() http.HandlerFunc {
-	slog := utils.LogFromContext(context.TODO())
-	if cmdflags.LogLevel != utils.LogLevel_Type_DEBUG {
-		return func(w http.ResponseWriter, r *http.Request) {
-			w.Header().Add("Content-Type", "application/json")
-			w.WriteHeader(200)
-			fmt.Fprintf(w, `{"info": "To dump runtimes, please set the --log-level to debug"}`)
-		}
-	} else {
-		return func(w http.ResponseWriter, r *http.Request) {
-			w.Header().Add("Content-Type", "application/json")
-			slog.Debugf("dumping request: %s?%s", r.URL.Path, r.URL.Query().Encode())
-			if r.URL.Path == "/runtime/" {
-				w.WriteHeader(200)
-				d, _ := json.MarshalIndent(pkg.ActiveSIGs, "", "  ")
-				fmt.Fprintf(w, "%s", string(d))
-				return
-			} else if strings.HasPrefix(r.URL.Path, "/runtime/trail") {
-				rlts := map[string]interface{}{}
-
-				queries := r.URL.Query()
-				for k := range queries {
-					// for k, v := range queries {
-					switch k {
-					// case "gatewayclass":
-					// 	for _, cls := range v {
-					// 		gwc := pkg.ActiveSIGs.GetGatewayClass(cls)
-					// 		gws := pkg.ActiveSIGs.AttachedGateways(gwc)
-					// 		if rlt, err := pkg.ParseGatewayRelatedForClass(cls, gws); err != nil {
-					// 			w.WriteHeader(500)
-					// 			fmt.Fprintf(w, `{"error": "failed to parse gateway class: %s: %s"}`, cls, err.Error())
-					// 			return
-					// 		} else {
-					// 			rlts[cls] = rlt
-					// 		}
-					// 	}
-					default:
-						w.WriteHeader(400)
-						fmt.Fprintf(w, `{"error": "%s"}`, fmt.Sprintf("unsupported query type %s", k))
-						return
-					}
-				}
-				w.WriteHeader(200)
-				d, _ := json.MarshalIndent(rlts, "", "  ")
-				fmt.Fprintf(w, "%s", string(d))
-			}
-		}
-	}
-}
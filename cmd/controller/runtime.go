@@ -0,0 +1,102 @@
+package main
+
+import (
+	"crypto/subtle"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"os"
+	"strings"
+
+	"github.com/f5devcentral/bigip-kubernetes-gateway/internal/k8s"
+	"github.com/f5devcentral/bigip-kubernetes-gateway/internal/pkg"
+	"github.com/f5devcentral/f5-bigip-rest-go/utils"
+)
+
+// runtimeHandlers returns the /runtime/ debug endpoints to mount on the metrics server,
+// none if tokenFile is not set:
+//
+//	/runtime/                               the cached resources, with secret data redacted
+//	/runtime/trail?gatewayclass=<name>      the rendered resources and related services,
+//	/runtime/trail?gateway=<namespace/name> queries can be repeated and combined
+//	/runtime/trail?httproute=<namespace/name>
+//	/runtime/nodes                          the cached nodes
+//	/runtime/queues                         the pending deploy requests and BIG-IP worker states
+func runtimeHandlers(tokenFile string) map[string]http.Handler {
+	if tokenFile == "" {
+		return nil
+	}
+	return map[string]http.Handler{
+		"/runtime/": authenticated(tokenFile, http.HandlerFunc(dumpRuntime)),
+	}
+}
+
+// authenticated requires the request to carry the token in tokenFile as "Authorization: Bearer <token>".
+// The file is read on each request so that a rotated token takes effect without restart.
+func authenticated(tokenFile string, next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		b, err := os.ReadFile(tokenFile)
+		token := strings.TrimSpace(string(b))
+		if err != nil || token == "" {
+			responseJson(w, http.StatusServiceUnavailable, map[string]string{"error": "runtime token is not available"})
+			return
+		}
+		auth := r.Header.Get("Authorization")
+		given := strings.TrimPrefix(auth, "Bearer ")
+		if given == auth || subtle.ConstantTimeCompare([]byte(given), []byte(token)) != 1 {
+			w.Header().Set("WWW-Authenticate", "Bearer")
+			responseJson(w, http.StatusUnauthorized, map[string]string{"error": "unauthorized"})
+			return
+		}
+		next.ServeHTTP(w, r)
+	})
+}
+
+func dumpRuntime(w http.ResponseWriter, r *http.Request) {
+	slog := utils.LogFromContext(pkg.NewContext())
+	slog.Debugf("dumping request: %s?%s", r.URL.Path, r.URL.Query().Encode())
+
+	if r.Method != http.MethodGet {
+		responseJson(w, http.StatusMethodNotAllowed, map[string]string{"error": "only GET is allowed"})
+		return
+	}
+
+	switch strings.TrimSuffix(r.URL.Path, "/") {
+	case "/runtime":
+		if d, err := pkg.ActiveSIGs.Dump(); err != nil {
+			responseJson(w, http.StatusInternalServerError, map[string]string{"error": err.Error()})
+		} else {
+			responseJson(w, http.StatusOK, d)
+		}
+	case "/runtime/trail":
+		rlts := map[string]interface{}{}
+		for kind, keynames := range r.URL.Query() {
+			rlts[kind] = map[string]interface{}{}
+			for _, kn := range keynames {
+				t, err := pkg.Trail(kind, kn)
+				if err != nil {
+					responseJson(w, http.StatusBadRequest, map[string]string{"error": err.Error()})
+					return
+				}
+				rlts[kind].(map[string]interface{})[kn] = t
+			}
+		}
+		responseJson(w, http.StatusOK, rlts)
+	case "/runtime/nodes":
+		responseJson(w, http.StatusOK, k8s.NodeCache.All())
+	case "/runtime/queues":
+		responseJson(w, http.StatusOK, pkg.Queues())
+	default:
+		responseJson(w, http.StatusNotFound, map[string]string{"error": fmt.Sprintf("unknown path %s", r.URL.Path)})
+	}
+}
+
+func responseJson(w http.ResponseWriter, code int, body interface{}) {
+	d, err := json.MarshalIndent(body, "", "  ")
+	if err != nil {
+		code, d = http.StatusInternalServerError, []byte(fmt.Sprintf(`{"error": "%s"}`, err.Error()))
+	}
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(code)
+	fmt.Fprintf(w, "%s", string(d))
+}
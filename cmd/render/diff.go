@@ -0,0 +1,49 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+
+	"github.com/f5devcentral/bigip-kubernetes-gateway/internal/pkg"
+)
+
+// printDiffs prints the changes from the declaration given by --diff-against to the desired one.
+func printDiffs(w io.Writer, desired map[string]interface{}) error {
+	current, err := currentDeclaration(cmdflags.DiffAgainst)
+	if err != nil {
+		return fmt.Errorf("failed to get the current declaration: %s", err.Error())
+	}
+	diffs := pkg.DiffDeclarations(current, desired)
+
+	switch cmdflags.DiffFormat {
+	case "json":
+		encoder := json.NewEncoder(w)
+		encoder.SetEscapeHTML(false)
+		encoder.SetIndent("", "  ")
+		return encoder.Encode(diffs)
+	case "text":
+		_, err := io.WriteString(w, pkg.FormatDiffs(diffs))
+		return err
+	default:
+		return fmt.Errorf("unsupported diff format %s, valid values: text, json", cmdflags.DiffFormat)
+	}
+}
+
+// currentDeclaration reads the declaration from the live BIG-IP if target is a url, or from the file.
+func currentDeclaration(target string) (map[string]interface{}, error) {
+	if strings.HasPrefix(target, "https://") || strings.HasPrefix(target, "http://") {
+		return pkg.LiveDeclaration(target, cmdflags.BIGIPUsername, os.Getenv("BIGIP_PASSWORD"))
+	}
+	b, err := os.ReadFile(target)
+	if err != nil {
+		return nil, err
+	}
+	decl := map[string]interface{}{}
+	if err := json.Unmarshal(b, &decl); err != nil {
+		return nil, err
+	}
+	return decl, nil
+}
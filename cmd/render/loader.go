@@ -0,0 +1,231 @@
+package main
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+
+	v1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/runtime/serializer"
+	"k8s.io/apimachinery/pkg/util/yaml"
+	gatewayapi "sigs.k8s.io/gateway-api/apis/v1"
+	gatewayv1beta1 "sigs.k8s.io/gateway-api/apis/v1beta1"
+
+	"github.com/f5devcentral/bigip-kubernetes-gateway/internal/k8s"
+	"github.com/f5devcentral/bigip-kubernetes-gateway/internal/pkg"
+)
+
+// loadFiles decodes the objects from the YAML or JSON files, directories are walked
+// for *.yaml, *.yml and *.json files, and "-" stands for stdin.
+func loadFiles(paths []string) ([]runtime.Object, error) {
+	objs := []runtime.Object{}
+	for _, p := range paths {
+		if p == "-" {
+			decoded, err := decodeObjects(os.Stdin)
+			if err != nil {
+				return nil, fmt.Errorf("failed to load stdin: %s", err.Error())
+			}
+			objs = append(objs, decoded...)
+			continue
+		}
+		err := filepath.WalkDir(p, func(path string, d os.DirEntry, err error) error {
+			if err != nil {
+				return err
+			}
+			if d.IsDir() {
+				return nil
+			}
+			if path != p && !isManifest(path) {
+				return nil
+			}
+			f, err := os.Open(path)
+			if err != nil {
+				return err
+			}
+			defer f.Close()
+			decoded, err := decodeObjects(f)
+			if err != nil {
+				return fmt.Errorf("failed to load %s: %s", path, err.Error())
+			}
+			objs = append(objs, decoded...)
+			return nil
+		})
+		if err != nil {
+			return nil, err
+		}
+	}
+	return objs, nil
+}
+
+func isManifest(path string) bool {
+	switch strings.ToLower(filepath.Ext(path)) {
+	case ".yaml", ".yml", ".json":
+		return true
+	default:
+		return false
+	}
+}
+
+// decodeObjects decodes the multi-document YAML or JSON stream, empty documents are skipped.
+func decodeObjects(r io.Reader) ([]runtime.Object, error) {
+	decoder := serializer.NewCodecFactory(scheme).UniversalDeserializer()
+	reader := yaml.NewYAMLReader(bufio.NewReader(r))
+	objs := []runtime.Object{}
+	for {
+		doc, err := reader.Read()
+		if err == io.EOF {
+			return objs, nil
+		} else if err != nil {
+			return nil, err
+		}
+		if strings.TrimSpace(string(doc)) == "" || strings.TrimSpace(string(doc)) == "---" {
+			continue
+		}
+		obj, _, err := decoder.Decode(doc, nil, nil)
+		if err != nil {
+			return nil, err
+		}
+		objs = append(objs, obj)
+	}
+}
+
+// populate sets the supported objects to the caches, with the defaults the API server would apply,
+// the namespaces referred but not given are created with the name label only.
+func populate(objs []runtime.Object) error {
+	namespaces := map[string]bool{}
+	for _, obj := range objs {
+		switch obj.(type) {
+		case *v1.Namespace, *v1.Node, *gatewayapi.GatewayClass, *gatewayv1beta1.GatewayClass:
+		default:
+			// as what kubectl does for the namespaced ones
+			if mo, ok := obj.(metav1.Object); ok {
+				if mo.GetNamespace() == "" {
+					mo.SetNamespace(v1.NamespaceDefault)
+				}
+				namespaces[mo.GetNamespace()] = true
+			}
+		}
+		switch o := obj.(type) {
+		case *v1.Namespace:
+			pkg.ActiveSIGs.SetNamespace(o)
+		case *v1.Service:
+			pkg.ActiveSIGs.SetService(defaultService(o))
+		case *v1.Endpoints:
+			pkg.ActiveSIGs.SetEndpoints(o)
+		case *v1.Secret:
+			pkg.ActiveSIGs.SetSecret(o)
+		case *v1.Node:
+			if err := k8s.NodeCache.Set(o); err != nil {
+				return fmt.Errorf("failed to set node %s: %s", o.Name, err.Error())
+			}
+		case *gatewayapi.GatewayClass:
+			pkg.ActiveSIGs.SetGatewayClass(o)
+		case *gatewayv1beta1.GatewayClass:
+			pkg.ActiveSIGs.SetGatewayClass(&gatewayapi.GatewayClass{ObjectMeta: o.ObjectMeta, Spec: o.Spec})
+		case *gatewayapi.Gateway:
+			pkg.ActiveSIGs.SetGateway(defaultGateway(o))
+		case *gatewayv1beta1.Gateway:
+			pkg.ActiveSIGs.SetGateway(defaultGateway(&gatewayapi.Gateway{ObjectMeta: o.ObjectMeta, Spec: o.Spec}))
+		case *gatewayapi.HTTPRoute:
+			pkg.ActiveSIGs.SetHTTPRoute(defaultHTTPRoute(o))
+		case *gatewayv1beta1.HTTPRoute:
+			pkg.ActiveSIGs.SetHTTPRoute(defaultHTTPRoute(&gatewayapi.HTTPRoute{ObjectMeta: o.ObjectMeta, Spec: o.Spec}))
+		case *gatewayv1beta1.ReferenceGrant:
+			pkg.ActiveSIGs.SetReferenceGrant(o)
+		default:
+			// other resources in the manifests, e.g. Deployments, are irrelevant to the rendering.
+			fmt.Fprintf(os.Stderr, "skipped unsupported kind %s\n", obj.GetObjectKind().GroupVersionKind().Kind)
+		}
+	}
+	for ns := range namespaces {
+		if pkg.ActiveSIGs.GetNamespace(ns) == nil {
+			pkg.ActiveSIGs.SetNamespace(&v1.Namespace{
+				ObjectMeta: metav1.ObjectMeta{
+					Name:   ns,
+					Labels: map[string]string{"kubernetes.io/metadata.name": ns},
+				},
+			})
+		}
+	}
+	return nil
+}
+
+// defaultService applies the defaults of the Service which the member parsing relies on.
+func defaultService(svc *v1.Service) *v1.Service {
+	if svc.Spec.Type == "" {
+		svc.Spec.Type = v1.ServiceTypeClusterIP
+	}
+	for i := range svc.Spec.Ports {
+		if svc.Spec.Ports[i].Protocol == "" {
+			svc.Spec.Ports[i].Protocol = v1.ProtocolTCP
+		}
+	}
+	return svc
+}
+
+// defaultGateway applies the defaults of the Gateway CRD which the parsing relies on.
+func defaultGateway(gw *gatewayapi.Gateway) *gatewayapi.Gateway {
+	same, ipaddr := gatewayapi.NamespacesFromSame, gatewayapi.IPAddressType
+	for i := range gw.Spec.Addresses {
+		if gw.Spec.Addresses[i].Type == nil {
+			gw.Spec.Addresses[i].Type = &ipaddr
+		}
+	}
+	for i := range gw.Spec.Listeners {
+		ls := &gw.Spec.Listeners[i]
+		if ls.AllowedRoutes == nil {
+			ls.AllowedRoutes = &gatewayapi.AllowedRoutes{}
+		}
+		if ls.AllowedRoutes.Namespaces == nil {
+			ls.AllowedRoutes.Namespaces = &gatewayapi.RouteNamespaces{}
+		}
+		if ls.AllowedRoutes.Namespaces.From == nil {
+			ls.AllowedRoutes.Namespaces.From = &same
+		}
+	}
+	return gw
+}
+
+// defaultHTTPRoute applies the defaults of the HTTPRoute CRD which the parsing relies on.
+func defaultHTTPRoute(hr *gatewayapi.HTTPRoute) *gatewayapi.HTTPRoute {
+	pathType, pathValue := gatewayapi.PathMatchPathPrefix, "/"
+	defaultMatch := func() gatewayapi.HTTPRouteMatch {
+		return gatewayapi.HTTPRouteMatch{
+			Path: &gatewayapi.HTTPPathMatch{Type: &pathType, Value: &pathValue},
+		}
+	}
+	if len(hr.Spec.Rules) == 0 {
+		hr.Spec.Rules = []gatewayapi.HTTPRouteRule{{}}
+	}
+	for i := range hr.Spec.Rules {
+		rule := &hr.Spec.Rules[i]
+		if len(rule.Matches) == 0 {
+			rule.Matches = []gatewayapi.HTTPRouteMatch{defaultMatch()}
+		}
+		for j := range rule.Matches {
+			m := &rule.Matches[j]
+			if m.Path == nil {
+				m.Path = defaultMatch().Path
+			}
+			if m.Path.Type == nil {
+				m.Path.Type = &pathType
+			}
+			if m.Path.Value == nil {
+				m.Path.Value = &pathValue
+			}
+		}
+		for j := range rule.BackendRefs {
+			br := &rule.BackendRefs[j]
+			if br.Weight == nil {
+				weight := int32(1)
+				br.Weight = &weight
+			}
+		}
+	}
+	return hr
+}
@@ -0,0 +1,180 @@
+/*
+Copyright 2023.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+// render prints the AS3 declaration the controller would deploy for the Gateway API
+// resources given in YAML files, without a cluster or BIG-IP, for example:
+//
+//	render -f examples/simple-gateway -f services.yaml > as3.json
+//
+// or prints the changes of the virtuals, pools, iRules and certificates against the current declaration:
+//
+//	render -f manifests/ --diff-against https://10.250.15.180:443
+//
+// The Nodes hosting the Endpoints are needed as well to render the pool members,
+// and --cni-type if the Nodes are not annotated or conditioned by the CNI.
+//
+// The Gateways and HTTPRoutes failed to render are printed to stderr with a non-zero exit status,
+// while the declaration of the others is printed still.
+package main
+
+import (
+	"encoding/json"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"sort"
+	"strings"
+
+	"k8s.io/apimachinery/pkg/runtime"
+	utilruntime "k8s.io/apimachinery/pkg/util/runtime"
+	clientgoscheme "k8s.io/client-go/kubernetes/scheme"
+	gatewayapi "sigs.k8s.io/gateway-api/apis/v1"
+	gatewayv1beta1 "sigs.k8s.io/gateway-api/apis/v1beta1"
+
+	"github.com/f5devcentral/bigip-kubernetes-gateway/internal/k8s"
+	"github.com/f5devcentral/bigip-kubernetes-gateway/internal/pkg"
+	"github.com/f5devcentral/f5-bigip-rest-go/utils"
+)
+
+type CmdFlags struct {
+	Files          []string
+	ControllerName string
+	Classes        string
+	CNIType        string
+	TenantPrefix   string
+	ClusterName    string
+	InstanceID     string
+	DiffAgainst    string
+	DiffFormat     string
+	BIGIPUsername  string
+	RevealSecrets  bool
+}
+
+var (
+	scheme            = runtime.NewScheme()
+	cmdflags CmdFlags = CmdFlags{}
+)
+
+func init() {
+	utilruntime.Must(clientgoscheme.AddToScheme(scheme))
+	utilruntime.Must(gatewayapi.AddToScheme(scheme))
+	utilruntime.Must(gatewayv1beta1.AddToScheme(scheme))
+}
+
+func main() {
+	flag.Func("f", "The YAML or JSON file, or directory of them, to load resources from, '-' for stdin, can be repeated.", func(s string) error {
+		cmdflags.Files = append(cmdflags.Files, s)
+		return nil
+	})
+	flag.StringVar(&cmdflags.ControllerName, "controller-name", "f5.io/gateway-controller-name", "The controller name the gateway classes refer to.")
+	flag.StringVar(&cmdflags.Classes, "gateway-classes", "", "The gateway classes to render, concating multiple values with ',', "+
+		"default to all the ones of --controller-name.")
+	flag.StringVar(&cmdflags.CNIType, "cni-type", "", fmt.Sprintf("The CNI type of the cluster, detected from nodes if not set, "+
+		"valid values: %s", strings.Join(k8s.SupportedCNITypes, ",")))
+	flag.StringVar(&cmdflags.TenantPrefix, "tenant-prefix", "", "The same as the controller's --tenant-prefix.")
+	flag.StringVar(&cmdflags.ClusterName, "cluster-name", "", "The same as the controller's --cluster-name.")
+	flag.StringVar(&cmdflags.InstanceID, "instance-id", "", "The same as the controller's --instance-id, default to --controller-name.")
+	flag.StringVar(&cmdflags.DiffAgainst, "diff-against", "", "Print the changes of the objects against the current declaration "+
+		"instead, from a JSON file, e.g. rendered by the controller's --dry-run, or from a BIG-IP url like https://10.250.15.180:443, "+
+		"whose password is read from env BIGIP_PASSWORD.")
+	flag.StringVar(&cmdflags.DiffFormat, "diff-format", "text", "The format of the changes, valid values: text, json")
+	flag.StringVar(&cmdflags.BIGIPUsername, "bigip-username", "admin", "The username of the BIG-IP given by --diff-against.")
+	flag.BoolVar(&cmdflags.RevealSecrets, "reveal-secrets", false, "Print the private keys of the certificates in the declaration, "+
+		"which are redacted by default to keep them out of CI logs.")
+	flag.Parse()
+
+	if err := render(os.Stdout); err != nil {
+		fmt.Fprintf(os.Stderr, "%s\n", err.Error())
+		os.Exit(1)
+	}
+}
+
+func render(w io.Writer) error {
+	if len(cmdflags.Files) == 0 {
+		return fmt.Errorf("no file given by -f")
+	}
+	if err := k8s.ValidCNIType(cmdflags.CNIType); err != nil {
+		return err
+	}
+	k8s.CNIType = cmdflags.CNIType
+
+	// keep the output clean, the declaration is the only thing printed to stdout.
+	pkg.LogLevel = utils.LogLevel_Type_ERROR
+	pkg.ActiveSIGs.ControllerName = cmdflags.ControllerName
+	pkg.TenantPrefix, pkg.ClusterName, pkg.InstanceID = cmdflags.TenantPrefix, cmdflags.ClusterName, cmdflags.InstanceID
+	if pkg.InstanceID == "" {
+		pkg.InstanceID = cmdflags.ControllerName
+	}
+
+	objs, err := loadFiles(cmdflags.Files)
+	if err != nil {
+		return err
+	}
+	if err := populate(objs); err != nil {
+		return err
+	}
+
+	classes := []string{}
+	if cmdflags.Classes != "" {
+		classes = strings.Split(cmdflags.Classes, ",")
+	} else {
+		for _, gwc := range pkg.ActiveSIGs.GatewayClass {
+			if gwc.Spec.ControllerName == gatewayapi.GatewayController(cmdflags.ControllerName) {
+				classes = append(classes, gwc.Name)
+			}
+		}
+		sort.Strings(classes)
+	}
+	if len(classes) == 0 {
+		return fmt.Errorf("no gateway class of controller %s found", cmdflags.ControllerName)
+	}
+
+	as3, errs, err := pkg.RenderWithErrors(classes)
+	if err != nil {
+		return err
+	}
+	if cmdflags.DiffAgainst != "" {
+		err = printDiffs(w, as3)
+	} else {
+		if !cmdflags.RevealSecrets {
+			as3 = pkg.RedactDeclaration(as3)
+		}
+		// indented and unescaped for reviewing the iRules in diffs.
+		encoder := json.NewEncoder(w)
+		encoder.SetEscapeHTML(false)
+		encoder.SetIndent("", "  ")
+		err = encoder.Encode(as3)
+	}
+	if err != nil {
+		return err
+	}
+	return renderErrors(errs)
+}
+
+// renderErrors fails the rendering if any Gateway or HTTPRoute is skipped or rendered partially,
+// the declaration of the others is printed still.
+func renderErrors(errs []error) error {
+	if len(errs) == 0 {
+		return nil
+	}
+	msgs := []string{}
+	for _, e := range errs {
+		msgs = append(msgs, e.Error())
+	}
+	sort.Strings(msgs)
+	return fmt.Errorf("%d resources failed to render:\n%s", len(msgs), strings.Join(msgs, "\n"))
+}
@@ -0,0 +1,158 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/f5devcentral/bigip-kubernetes-gateway/internal/pkg"
+)
+
+const manifests = `
+apiVersion: gateway.networking.k8s.io/v1
+kind: GatewayClass
+metadata:
+  name: bigip
+spec:
+  controllerName: f5.io/gateway-controller-name
+---
+apiVersion: gateway.networking.k8s.io/v1
+kind: Gateway
+metadata:
+  name: gw
+  namespace: apps
+spec:
+  gatewayClassName: bigip
+  addresses:
+    - value: 10.250.17.143
+  listeners:
+    - name: http
+      port: 80
+      protocol: HTTP
+---
+apiVersion: gateway.networking.k8s.io/v1beta1
+kind: HTTPRoute
+metadata:
+  name: route
+  namespace: apps
+spec:
+  parentRefs:
+    - name: gw
+      sectionName: http
+  rules:
+    - backendRefs:
+        - name: svc
+          port: 80
+---
+apiVersion: v1
+kind: Service
+metadata:
+  name: svc
+  namespace: apps
+spec:
+  ports:
+    - port: 80
+---
+apiVersion: v1
+kind: Endpoints
+metadata:
+  name: svc
+  namespace: apps
+subsets:
+  - addresses:
+      - ip: 10.42.0.10
+        nodeName: node1
+    ports:
+      - port: 80
+---
+apiVersion: v1
+kind: Node
+metadata:
+  name: node1
+  annotations:
+    projectcalico.org/IPv4Address: 10.250.15.10/24
+status:
+  addresses:
+    - type: InternalIP
+      address: 10.250.15.10
+`
+
+func Test_render(t *testing.T) {
+	fn := filepath.Join(t.TempDir(), "manifests.yaml")
+	if err := os.WriteFile(fn, []byte(manifests), 0644); err != nil {
+		t.Fatal(err)
+	}
+	cmdflags = CmdFlags{Files: []string{fn}, ControllerName: "f5.io/gateway-controller-name", CNIType: "calico"}
+
+	var out bytes.Buffer
+	if err := render(&out); err != nil {
+		t.Fatalf("render() error: %s", err.Error())
+	}
+	var as3 map[string]interface{}
+	if err := json.Unmarshal(out.Bytes(), &as3); err != nil {
+		t.Fatalf("invalid rendered declaration: %s", err.Error())
+	}
+	decl := as3["declaration"].(map[string]interface{})
+	app := decl["bigip"].(map[string]interface{})["serviceMain"].(map[string]interface{})
+	for _, k := range []string{"gw.apps.gw.http.0", "hr.apps.route"} {
+		if _, f := app[k]; !f {
+			t.Errorf("expected %s rendered in tenant bigip, got %v", k, app)
+		}
+	}
+	pool := decl["apps"].(map[string]interface{})["serviceMain"].(map[string]interface{})["svc"].(map[string]interface{})
+	if members := pool["members"].([]interface{}); len(members) != 1 {
+		t.Errorf("expected 1 pool member entry, got %v", pool["members"])
+	}
+}
+
+const mirrorRoute = `
+---
+apiVersion: gateway.networking.k8s.io/v1beta1
+kind: HTTPRoute
+metadata:
+  name: mirror
+  namespace: apps
+spec:
+  parentRefs:
+    - name: gw
+      sectionName: http
+  rules:
+    - filters:
+        - type: RequestMirror
+          requestMirror:
+            backendRef:
+              name: svc
+              port: 80
+      backendRefs:
+        - name: svc
+          port: 80
+`
+
+func Test_render_failedRoute(t *testing.T) {
+	fn := filepath.Join(t.TempDir(), "manifests.yaml")
+	if err := os.WriteFile(fn, []byte(manifests+mirrorRoute), 0644); err != nil {
+		t.Fatal(err)
+	}
+	defer pkg.ActiveSIGs.UnsetHTTPRoute("apps/mirror")
+	cmdflags = CmdFlags{Files: []string{fn}, ControllerName: "f5.io/gateway-controller-name", CNIType: "calico"}
+
+	var out bytes.Buffer
+	err := render(&out)
+	if err == nil || !strings.Contains(err.Error(), "HTTPRoute apps/mirror: ") {
+		t.Fatalf("expected the failed route reported, got %v", err)
+	}
+	var as3 map[string]interface{}
+	if err := json.Unmarshal(out.Bytes(), &as3); err != nil {
+		t.Fatalf("expected the declaration of the others rendered still: %s", err.Error())
+	}
+	app := as3["declaration"].(map[string]interface{})["bigip"].(map[string]interface{})["serviceMain"].(map[string]interface{})
+	if _, f := app["hr.apps.route"]; !f {
+		t.Errorf("expected hr.apps.route rendered, got %v", app)
+	}
+	if _, f := app["hr.apps.mirror"]; f {
+		t.Errorf("expected hr.apps.mirror skipped")
+	}
+}
@@ -32,6 +32,8 @@ import (
 type GatewayReconciler struct {
 	ObjectType client.Object
 	Client     client.Client
+	// Reader reads the secrets newly referenced by the gateway.
+	Reader client.Reader
 	// LogLevel   string
 }
 
@@ -60,6 +62,10 @@ func (r *GatewayReconciler) Reconcile(ctx context.Context, req ctrl.Request) (ct
 			gw := pkg.ActiveSIGs.GetGateway(req.NamespacedName.String())
 			cls := string(gw.Spec.GatewayClassName)
 			pkg.ActiveSIGs.UnsetGateway(req.NamespacedName.String())
+			pkg.ForgetStatus("Gateway", req.Namespace, req.Name)
+			if err := pkg.ActiveSIGs.SyncReferencedSecrets(lctx, r.Reader); err != nil {
+				return ctrl.Result{}, err
+			}
 			if err := pkg.DeployForEvent(lctx, []string{cls}); err != nil {
 				return ctrl.Result{}, err
 			} else {
@@ -78,6 +84,9 @@ func (r *GatewayReconciler) Reconcile(ctx context.Context, req ctrl.Request) (ct
 			cls = append(cls, string(gw.Spec.GatewayClassName))
 		}
 		cls = utils.Unified(cls)
+		if err := pkg.ActiveSIGs.SyncReferencedSecrets(lctx, r.Reader); err != nil {
+			return ctrl.Result{}, err
+		}
 		if err := pkg.DeployForEvent(lctx, cls); err != nil {
 			return ctrl.Result{}, err
 		} else {
@@ -30,6 +30,8 @@ import (
 type SecretReconciler struct {
 	ObjectType client.Object
 	Client     client.Client
+	// Reader reads the secrets with data, which are dropped from the Client's cache.
+	Reader client.Reader
 	// LogLevel   string
 }
 
@@ -73,10 +75,16 @@ func (r *SecretReconciler) Reconcile(ctx context.Context, req ctrl.Request) (ctr
 		}
 	} else {
 		// upsert
-		scrt := obj.DeepCopy()
+		scrt, err := pkg.ActiveSIGs.LoadSecret(lctx, r.Reader, req.NamespacedName.String())
+		if err != nil {
+			return ctrl.Result{}, err
+		}
+		if scrt == nil {
+			slog.Debugf("secret %s is not referenced by gateways, skipped", req.NamespacedName)
+			return ctrl.Result{}, nil
+		}
 		gws, err := pkg.ActiveSIGs.GatewayRefsOfSecret(scrt)
 		if err != nil {
-			pkg.ActiveSIGs.SetSecret(obj.DeepCopy())
 			return ctrl.Result{}, err
 		}
 		cls := []string{}
@@ -84,7 +92,6 @@ func (r *SecretReconciler) Reconcile(ctx context.Context, req ctrl.Request) (ctr
 			cls = append(cls, string(gw.Spec.GatewayClassName))
 		}
 
-		pkg.ActiveSIGs.SetSecret(obj.DeepCopy())
 		if err := pkg.DeployForEvent(lctx, cls); err != nil {
 			return ctrl.Result{}, err
 		}
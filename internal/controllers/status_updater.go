@@ -0,0 +1,135 @@
+/*
+Copyright 2022.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controllers
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"github.com/f5devcentral/bigip-kubernetes-gateway/internal/pkg"
+	"github.com/f5devcentral/f5-bigip-rest-go/utils"
+	"k8s.io/apimachinery/pkg/api/meta"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/types"
+	"k8s.io/client-go/util/retry"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	gatewayapi "sigs.k8s.io/gateway-api/apis/v1"
+)
+
+// StatusUpdater writes the parsing results queued in pkg.StatusUpdates
+// to the status of the Gateways and HTTPRoutes.
+func StatusUpdater(stopCh chan struct{}, cli client.Client) {
+	handleNext := func() {
+		s := pkg.StatusUpdates.Get().(pkg.ObjectStatus)
+		slog := utils.LogFromContext(pkg.NewContext())
+		err := retry.RetryOnConflict(retry.DefaultRetry, func() error {
+			return updateStatus(context.TODO(), cli, s)
+		})
+		if err != nil {
+			slog.Warnf("failed to update status of %s %s/%s: %s", s.Kind, s.Namespace, s.Name, err.Error())
+			time.AfterFunc(time.Second, func() { pkg.StatusUpdates.Add(s) })
+		}
+	}
+	for {
+		select {
+		case <-stopCh:
+			return
+		default:
+			handleNext()
+		}
+	}
+}
+
+func updateStatus(ctx context.Context, cli client.Client, s pkg.ObjectStatus) error {
+	key := types.NamespacedName{Namespace: s.Namespace, Name: s.Name}
+	switch s.Kind {
+	case "Gateway":
+		var gw gatewayapi.Gateway
+		if err := cli.Get(ctx, key, &gw); err != nil {
+			return client.IgnoreNotFound(err)
+		}
+		setGatewayStatus(&gw, s)
+		return cli.Status().Update(ctx, &gw)
+	case "HTTPRoute":
+		var hr gatewayapi.HTTPRoute
+		if err := cli.Get(ctx, key, &hr); err != nil {
+			return client.IgnoreNotFound(err)
+		}
+		setHTTPRouteStatus(&hr, s, gatewayapi.GatewayController(pkg.ActiveSIGs.ControllerName))
+		return cli.Status().Update(ctx, &hr)
+	default:
+		return fmt.Errorf("unsupported kind of status: %s", s.Kind)
+	}
+}
+
+func statusCondition(s pkg.ObjectStatus, generation int64) metav1.Condition {
+	condition := metav1.Condition{
+		Type:               s.Type,
+		Status:             metav1.ConditionTrue,
+		ObservedGeneration: generation,
+		Reason:             s.Reason,
+		Message:            s.Message,
+	}
+	if !s.Status {
+		condition.Status = metav1.ConditionFalse
+	}
+	return condition
+}
+
+func setGatewayStatus(gw *gatewayapi.Gateway, s pkg.ObjectStatus) {
+	meta.SetStatusCondition(&gw.Status.Conditions, statusCondition(s, gw.Generation))
+}
+
+func setHTTPRouteStatus(hr *gatewayapi.HTTPRoute, s pkg.ObjectStatus, controller gatewayapi.GatewayController) {
+	parents := []gatewayapi.RouteParentStatus{}
+	for _, ps := range hr.Status.Parents {
+		if ps.ControllerName != controller {
+			parents = append(parents, ps)
+		}
+	}
+	for _, pr := range hr.Spec.ParentRefs {
+		if !isManagedParent(hr, pr, controller) {
+			continue
+		}
+		ps := gatewayapi.RouteParentStatus{
+			ParentRef:      pr,
+			ControllerName: controller,
+		}
+		for _, o := range hr.Status.Parents {
+			if o.ControllerName == controller && utils.DeepEqual(o.ParentRef, pr) {
+				ps.Conditions = o.Conditions
+			}
+		}
+		meta.SetStatusCondition(&ps.Conditions, statusCondition(s, hr.Generation))
+		parents = append(parents, ps)
+	}
+	hr.Status.Parents = parents
+}
+
+func isManagedParent(hr *gatewayapi.HTTPRoute, pr gatewayapi.ParentReference, controller gatewayapi.GatewayController) bool {
+	ns := hr.Namespace
+	if pr.Namespace != nil {
+		ns = string(*pr.Namespace)
+	}
+	gw := pkg.ActiveSIGs.GetGateway(utils.Keyname(ns, string(pr.Name)))
+	if gw == nil {
+		return false
+	}
+	gwc := pkg.ActiveSIGs.GetGatewayClass(string(gw.Spec.GatewayClassName))
+	return gwc != nil && gwc.Spec.ControllerName == controller
+}
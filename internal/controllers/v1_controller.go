@@ -27,6 +27,7 @@ import (
 	"sigs.k8s.io/controller-runtime/pkg/client"
 
 	v1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
 )
 
 type EndpointsReconciler struct {
@@ -156,9 +157,41 @@ func (r *NodeReconciler) Reconcile(ctx context.Context, req ctrl.Request) (ctrl.
 	} else {
 		k8s.NodeCache.Set(obj.DeepCopy())
 	}
+	pkg.RequestNetSync()
 	return ctrl.Result{}, nil
 }
 
 func (r *NodeReconciler) GetResObject() client.Object {
 	return r.ObjectType
 }
+
+// BlockAffinityReconciler watches the calico IPAM block affinities, for the routes to the pod CIDRs of the nodes.
+type BlockAffinityReconciler struct {
+	ObjectType client.Object
+	Client     client.Client
+}
+
+func (r *BlockAffinityReconciler) Reconcile(ctx context.Context, req ctrl.Request) (ctrl.Result, error) {
+	if !pkg.ActiveSIGs.SyncedAtStart {
+		<-time.After(100 * time.Millisecond)
+		return ctrl.Result{Requeue: true}, nil
+	}
+
+	obj := &unstructured.Unstructured{}
+	obj.SetGroupVersionKind(k8s.BlockAffinityGVK)
+	if err := r.Client.Get(ctx, req.NamespacedName, obj); err != nil {
+		if client.IgnoreNotFound(err) == nil {
+			k8s.NodeCache.UnsetBlockAffinity(req.Name)
+		} else {
+			return ctrl.Result{}, err
+		}
+	} else {
+		k8s.NodeCache.SetBlockAffinity(obj)
+	}
+	pkg.RequestNetSync()
+	return ctrl.Result{}, nil
+}
+
+func (r *BlockAffinityReconciler) GetResObject() client.Object {
+	return r.ObjectType
+}
@@ -3,15 +3,19 @@ package k8s
 import (
 	"encoding/json"
 	"fmt"
+	"sort"
 	"strings"
 
+	"github.com/f5devcentral/f5-bigip-rest-go/utils"
 	v1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
 )
 
 func init() {
 	NodeCache = Nodes{
-		Items: map[string]*K8Node{},
-		mutex: make(chan bool, 1),
+		Items:  map[string]*K8Node{},
+		blocks: map[string]blockAffinity{},
+		mutex:  make(chan bool, 1),
 	}
 }
 
@@ -28,18 +32,19 @@ func (ns *Nodes) Set(n *v1.Node) error {
 	cnitype := detectCNIType(n)
 	switch cnitype {
 	case "cilium":
-		addrs := n.Status.Addresses
-		ipaddr := ""
-		for _, addr := range addrs {
-			if addr.Type == v1.NodeInternalIP {
-				ipaddr = addr.Address
-				break
-			}
-		}
+		ipaddr, ipaddrv6 := nodeInternalIPs(n)
 		node.Name = n.Name
 		node.IpAddr = ipaddr
-		node.NetType = ""
-		node.MacAddr = ipv4ToMac(ipaddr)
+		node.IpAddrV6 = ipaddrv6
+		// cilium vxlan tunnel endpoints use the MACs derived from node IPs,
+		// one tunnel endpoint carries both address families.
+		node.NetType = "vxlan"
+		if ipaddr != "" {
+			node.MacAddr = ipToMac(ipaddr)
+		} else {
+			node.MacAddr = ipToMac(ipaddrv6)
+		}
+		node.MacAddrV6 = node.MacAddr
 	case "flannel":
 		// flannel v4
 		if _, ok := n.Annotations["flannel.alpha.coreos.com/backend-data"]; ok {
@@ -73,16 +78,70 @@ func (ns *Nodes) Set(n *v1.Node) error {
 	case "calico":
 		ipmask := n.Annotations["projectcalico.org/IPv4Address"]
 		ipaddr := strings.Split(ipmask, "/")[0]
+		ipmaskv6 := n.Annotations["projectcalico.org/IPv6Address"]
+		ipaddrv6 := strings.Split(ipmaskv6, "/")[0]
 		node = K8Node{
-			Name:    n.Name,
-			IpAddr:  ipaddr,
-			NetType: "calico-underlay",
-			MacAddr: "",
+			Name:     n.Name,
+			IpAddr:   ipaddr,
+			IpAddrV6: ipaddrv6,
+			NetType:  "calico-underlay",
+			MacAddr:  "",
+		}
+	case "ovn-kubernetes":
+		// geneve overlay is not reachable from BIG-IP, node IPs are used for NodePort members.
+		node.IpAddr, node.IpAddrV6 = nodeInternalIPs(n)
+		if ifaddr, ok := n.Annotations["k8s.ovn.org/node-primary-ifaddr"]; ok {
+			var v map[string]string
+			if err := json.Unmarshal([]byte(ifaddr), &v); err != nil {
+				return fmt.Errorf("failed to unmarshal k8s.ovn.org/node-primary-ifaddr: %s", err.Error())
+			}
+			if ipv4, ok := v["ipv4"]; ok && ipv4 != "" {
+				node.IpAddr = strings.Split(ipv4, "/")[0]
+			}
+			if ipv6, ok := v["ipv6"]; ok && ipv6 != "" {
+				node.IpAddrV6 = strings.Split(ipv6, "/")[0]
+			}
 		}
+		if subnets, ok := n.Annotations["k8s.ovn.org/node-subnets"]; ok {
+			cidrs, err := ovnNodeSubnets(subnets)
+			if err != nil {
+				return fmt.Errorf("failed to unmarshal k8s.ovn.org/node-subnets: %s", err.Error())
+			}
+			node.PodCIDRs = cidrs
+		}
+		node.NetType = "ovn-kubernetes"
+	case "antrea":
+		node.IpAddr, node.IpAddrV6 = nodeInternalIPs(n)
+		if addrs, ok := n.Annotations["node.antrea.io/transport-addresses"]; ok {
+			for _, addr := range strings.Split(addrs, ",") {
+				if utils.IsIpv6(addr) {
+					node.IpAddrV6 = addr
+				} else if addr != "" {
+					node.IpAddr = addr
+				}
+			}
+		}
+		node.NetType = "antrea"
 	default:
 		return fmt.Errorf("unknown CNI type: %s for node %s", cnitype, n.Name)
 	}
 
+	// complement the node addresses of the families not provided by CNI, for NodePort members.
+	ipaddr, ipaddrv6 := nodeInternalIPs(n)
+	if node.IpAddr == "" {
+		node.IpAddr = ipaddr
+	}
+	if node.IpAddrV6 == "" {
+		node.IpAddrV6 = ipaddrv6
+	}
+
+	if len(node.PodCIDRs) == 0 {
+		node.PodCIDRs = n.Spec.PodCIDRs
+	}
+	if len(node.PodCIDRs) == 0 && n.Spec.PodCIDR != "" {
+		node.PodCIDRs = []string{n.Spec.PodCIDR}
+	}
+
 	NodeCache.mutex <- true
 	NodeCache.Items[n.Name] = &node
 	<-NodeCache.mutex
@@ -113,9 +172,44 @@ func (ns *Nodes) All() map[string]K8Node {
 	NodeCache.mutex <- true
 	defer func() { <-NodeCache.mutex }()
 
+	cidrs := map[string][]string{}
+	for _, b := range ns.blocks {
+		cidrs[b.node] = append(cidrs[b.node], b.cidr)
+	}
 	rlt := map[string]K8Node{}
 	for k, n := range ns.Items {
-		rlt[k] = *n
+		node := *n
+		// calico allocates pod IPs from the IPAM blocks instead of the node's podCIDRs.
+		if node.NetType == "calico-underlay" && len(cidrs[k]) > 0 {
+			sort.Strings(cidrs[k])
+			node.PodCIDRs = cidrs[k]
+		}
+		rlt[k] = node
 	}
 	return rlt
 }
+
+// SetBlockAffinity records the calico IPAM block affine to the node, the pending or deleted ones are removed.
+func (ns *Nodes) SetBlockAffinity(obj *unstructured.Unstructured) {
+	node, _, _ := unstructured.NestedString(obj.Object, "spec", "node")
+	cidr, _, _ := unstructured.NestedString(obj.Object, "spec", "cidr")
+	state, _, _ := unstructured.NestedString(obj.Object, "spec", "state")
+	deleted, _, _ := unstructured.NestedString(obj.Object, "spec", "deleted")
+	if node == "" || cidr == "" || state != "confirmed" || deleted == "true" {
+		ns.UnsetBlockAffinity(obj.GetName())
+		return
+	}
+
+	ns.mutex <- true
+	defer func() { <-ns.mutex }()
+	if ns.blocks == nil {
+		ns.blocks = map[string]blockAffinity{}
+	}
+	ns.blocks[obj.GetName()] = blockAffinity{node: node, cidr: cidr}
+}
+
+func (ns *Nodes) UnsetBlockAffinity(name string) {
+	ns.mutex <- true
+	defer func() { <-ns.mutex }()
+	delete(ns.blocks, name)
+}
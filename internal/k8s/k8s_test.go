@@ -0,0 +1,145 @@
+package k8s
+
+import (
+	"reflect"
+	"testing"
+
+	v1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+)
+
+func TestNodes_Set(t *testing.T) {
+	cases := []struct {
+		name     string
+		node     v1.Node
+		expected K8Node
+	}{
+		{
+			name: "ovn-kubernetes",
+			node: v1.Node{
+				ObjectMeta: metav1.ObjectMeta{
+					Name: "node1",
+					Annotations: map[string]string{
+						"k8s.ovn.org/node-primary-ifaddr": `{"ipv4":"10.0.0.1/24"}`,
+						"k8s.ovn.org/node-subnets":        `{"default":["10.244.1.0/24"]}`,
+					},
+				},
+				Status: v1.NodeStatus{
+					Addresses: []v1.NodeAddress{{Type: v1.NodeInternalIP, Address: "192.168.0.1"}},
+				},
+			},
+			expected: K8Node{Name: "node1", IpAddr: "10.0.0.1", NetType: "ovn-kubernetes", PodCIDRs: []string{"10.244.1.0/24"}},
+		},
+		{
+			name: "cilium dual-stack",
+			node: v1.Node{
+				ObjectMeta: metav1.ObjectMeta{Name: "node3"},
+				Status: v1.NodeStatus{
+					Conditions: []v1.NodeCondition{{Reason: "CiliumIsUp"}},
+					Addresses: []v1.NodeAddress{
+						{Type: v1.NodeInternalIP, Address: "fd00::3"},
+						{Type: v1.NodeInternalIP, Address: "10.0.0.3"},
+					},
+				},
+			},
+			expected: K8Node{Name: "node3", IpAddr: "10.0.0.3", IpAddrV6: "fd00::3", NetType: "vxlan",
+				MacAddr: "0a:0a:0a:00:00:03", MacAddrV6: "0a:0a:0a:00:00:03"},
+		},
+		{
+			name: "calico dual-stack",
+			node: v1.Node{
+				ObjectMeta: metav1.ObjectMeta{
+					Name: "node4",
+					Annotations: map[string]string{
+						"projectcalico.org/IPv4Address": "10.0.0.4/24",
+						"projectcalico.org/IPv6Address": "fd00::4/64",
+					},
+				},
+				Spec: v1.NodeSpec{PodCIDRs: []string{"10.244.4.0/24", "fd00:10:244:4::/64"}},
+				Status: v1.NodeStatus{
+					Conditions: []v1.NodeCondition{{Reason: "CalicoIsUp"}},
+				},
+			},
+			expected: K8Node{Name: "node4", IpAddr: "10.0.0.4", IpAddrV6: "fd00::4", NetType: "calico-underlay",
+				PodCIDRs: []string{"10.244.4.0/24", "fd00:10:244:4::/64"}},
+		},
+		{
+			name: "antrea",
+			node: v1.Node{
+				ObjectMeta: metav1.ObjectMeta{
+					Name: "node2",
+					Annotations: map[string]string{
+						"node.antrea.io/transport-addresses": "10.0.0.2",
+					},
+				},
+				Spec: v1.NodeSpec{PodCIDR: "10.244.2.0/24"},
+				Status: v1.NodeStatus{
+					Addresses: []v1.NodeAddress{{Type: v1.NodeInternalIP, Address: "192.168.0.2"}},
+				},
+			},
+			expected: K8Node{Name: "node2", IpAddr: "10.0.0.2", NetType: "antrea", PodCIDRs: []string{"10.244.2.0/24"}},
+		},
+	}
+
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			setupNodes(t)
+			if err := NodeCache.Set(&c.node); err != nil {
+				t.Fatalf("unexpected error: %s", err.Error())
+			}
+			if nd := NodeCache.Get(c.node.Name); nd == nil || !reflect.DeepEqual(*nd, c.expected) {
+				t.Errorf("expected %v, got %v", c.expected, nd)
+			}
+		})
+	}
+}
+
+func Test_detectCNIType(t *testing.T) {
+	node := v1.Node{ObjectMeta: metav1.ObjectMeta{Name: "node1"}}
+	if kind := detectCNIType(&node); kind != "unknown" {
+		t.Errorf("expected unknown, got %s", kind)
+	}
+
+	CNIType = "antrea"
+	defer func() { CNIType = "" }()
+	if kind := detectCNIType(&node); kind != "antrea" {
+		t.Errorf("expected antrea, got %s", kind)
+	}
+}
+
+func TestNodes_blockAffinities(t *testing.T) {
+	node := v1.Node{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:        "calico1",
+			Annotations: map[string]string{"projectcalico.org/IPv4Address": "10.0.0.1/24"},
+		},
+		Spec:   v1.NodeSpec{PodCIDRs: []string{"10.244.1.0/24"}},
+		Status: v1.NodeStatus{Conditions: []v1.NodeCondition{{Reason: "CalicoIsUp"}}},
+	}
+	if err := NodeCache.Set(&node); err != nil {
+		t.Fatalf("failed to set node: %s", err.Error())
+	}
+	defer NodeCache.Unset("calico1")
+	if cidrs := NodeCache.All()["calico1"].PodCIDRs; !reflect.DeepEqual(cidrs, []string{"10.244.1.0/24"}) {
+		t.Fatalf("expected podCIDRs used without block affinities, got %v", cidrs)
+	}
+
+	block := func(name, cidr, state string) *unstructured.Unstructured {
+		obj := &unstructured.Unstructured{Object: map[string]interface{}{
+			"spec": map[string]interface{}{"node": "calico1", "cidr": cidr, "state": state, "deleted": "false"},
+		}}
+		obj.SetGroupVersionKind(BlockAffinityGVK)
+		obj.SetName(name)
+		return obj
+	}
+	NodeCache.SetBlockAffinity(block("calico1-192-168-1-0-26", "192.168.1.0/26", "confirmed"))
+	NodeCache.SetBlockAffinity(block("calico1-192-168-0-0-26", "192.168.0.0/26", "confirmed"))
+	NodeCache.SetBlockAffinity(block("calico1-192-168-2-0-26", "192.168.2.0/26", "pending"))
+	defer NodeCache.UnsetBlockAffinity("calico1-192-168-0-0-26")
+	defer NodeCache.UnsetBlockAffinity("calico1-192-168-1-0-26")
+
+	if cidrs := NodeCache.All()["calico1"].PodCIDRs; !reflect.DeepEqual(cidrs, []string{"192.168.0.0/26", "192.168.1.0/26"}) {
+		t.Fatalf("expected the confirmed blocks used as pod CIDRs, got %v", cidrs)
+	}
+}
@@ -2,16 +2,24 @@ package k8s
 
 type Nodes struct {
 	Items map[string]*K8Node
-	mutex chan bool
+	// blocks are the calico IPAM blocks affine to the nodes, keyed by the BlockAffinity names.
+	blocks map[string]blockAffinity
+	mutex  chan bool
+}
+
+type blockAffinity struct {
+	node string
+	cidr string
 }
 
 type K8Node struct {
-	MacAddr   string `json:"macaddr"`
-	IpAddr    string `json:"ipaddr"`
-	MacAddrV6 string `json:"macaddrv6"`
-	IpAddrV6  string `json:"ipaddrv6"`
-	Name      string `json:"name"`
-	NetType   string `json:"nettype"`
+	MacAddr   string   `json:"macaddr"`
+	IpAddr    string   `json:"ipaddr"`
+	MacAddrV6 string   `json:"macaddrv6"`
+	IpAddrV6  string   `json:"ipaddrv6"`
+	Name      string   `json:"name"`
+	NetType   string   `json:"nettype"`
+	PodCIDRs  []string `json:"podcidrs"`
 }
 
 type SvcEpsMember struct {
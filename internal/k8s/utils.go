@@ -1,7 +1,10 @@
 package k8s
 
 import (
+	"encoding/json"
 	"fmt"
+	"net"
+	"sort"
 	"strconv"
 	"strings"
 
@@ -9,70 +12,176 @@ import (
 	v1 "k8s.io/api/core/v1"
 )
 
-func FormatMembersFromServiceEndpoints(svc *v1.Service, eps *v1.Endpoints) ([]SvcEpsMember, error) {
+// FormatMembersFromServiceEndpoints returns pool members of the service with the given member mode,
+// see MemberMode_* for the valid modes.
+func FormatMembersFromServiceEndpoints(svc *v1.Service, eps *v1.Endpoints, mode string) ([]SvcEpsMember, error) {
 	if eps == nil || svc == nil {
 		return []SvcEpsMember{}, fmt.Errorf("the given service or endpoints is nil")
 	}
 
-	members := []SvcEpsMember{}
 	serviceType := svc.Spec.Type
+	if mode == MemberMode_Auto {
+		switch serviceType {
+		case v1.ServiceTypeNodePort: // "NodePort"
+			mode = MemberMode_NodePort
+		case v1.ServiceTypeClusterIP: // "ClusterIP"
+			mode = MemberMode_Cluster
+		case v1.ServiceTypeLoadBalancer: // "LoadBalancer"
+			return []SvcEpsMember{}, fmt.Errorf("not supported service type: %s", serviceType)
+		case v1.ServiceTypeExternalName: // "ExternalName"
+			return []SvcEpsMember{}, fmt.Errorf("not supported service type: %s", serviceType)
+		default:
+			return []SvcEpsMember{}, fmt.Errorf("unknown service type: %s", serviceType)
+		}
+	}
+
+	switch mode {
+	case MemberMode_Cluster:
+		return clusterMembers(svc, eps)
+	case MemberMode_NodePort:
+		localOnly := svc.Spec.ExternalTrafficPolicy == v1.ServiceExternalTrafficPolicyLocal
+		return nodePortMembers(svc, eps, localOnly)
+	case MemberMode_NodePortLocal:
+		return nodePortMembers(svc, eps, true)
+	default:
+		return []SvcEpsMember{}, fmt.Errorf("unknown member mode: %s", mode)
+	}
+}
+
+// ValidMemberMode returns error if the given mode is not one of MemberMode_*.
+func ValidMemberMode(mode string) error {
+	switch mode {
+	case MemberMode_Auto, MemberMode_Cluster, MemberMode_NodePort, MemberMode_NodePortLocal:
+		return nil
+	default:
+		return fmt.Errorf("unknown member mode: %s, valid values: %s", mode,
+			strings.Join([]string{MemberMode_Cluster, MemberMode_NodePort, MemberMode_NodePortLocal}, ","))
+	}
+}
 
-	switch serviceType {
-	case v1.ServiceTypeNodePort: // "NodePort"
-		nodeIPs := []string{}
-		for _, nd := range NodeCache.All() {
-			if nd.IpAddr == "" {
-				return []SvcEpsMember{}, utils.RetryErrorf("node ip %s not found yet", nd.Name)
+// clusterMembers returns pod ip:port members of the address families of the service.
+func clusterMembers(svc *v1.Service, eps *v1.Endpoints) ([]SvcEpsMember, error) {
+	members := []SvcEpsMember{}
+	for _, subset := range eps.Subsets {
+		for _, port := range subset.Ports {
+			for _, addr := range subset.Addresses {
+				if !familyMatches(svc, addr.IP) {
+					continue
+				}
+				member := SvcEpsMember{
+					TargetPort: int(port.Port),
+					IpAddr:     addr.IP,
+				}
+				if addr.NodeName == nil {
+					return []SvcEpsMember{}, fmt.Errorf("%s node name was not appointed in endpoints", addr.IP)
+				}
+				if k8no := NodeCache.Get(*addr.NodeName); k8no == nil {
+					return []SvcEpsMember{}, utils.RetryErrorf("%s not found yet", *addr.NodeName)
+				} else if k8no.NetType == "vxlan" {
+					if utils.IsIpv6(addr.IP) {
+						member.MacAddr = k8no.MacAddrV6
+					} else {
+						member.MacAddr = k8no.MacAddr
+					}
+				}
+				members = append(members, member)
 			}
-			nodeIPs = append(nodeIPs, nd.IpAddr)
 		}
+	}
+	return members, nil
+}
 
-		for _, port := range svc.Spec.Ports {
-			for _, ip := range nodeIPs {
-				members = append(members, SvcEpsMember{
-					// TargetPort: port.TargetPort.IntValue(),
-					// NodePort:   int(port.NodePort),
-					TargetPort: int(port.NodePort),
-					IpAddr:     ip,
-				})
-			}
+// familyMatches returns true if the address family of ipaddr is one of the service's ipFamilies,
+// services without ipFamilies(e.g. headless ones without selectors) match all.
+func familyMatches(svc *v1.Service, ipaddr string) bool {
+	if len(svc.Spec.IPFamilies) == 0 {
+		return true
+	}
+	family := v1.IPv4Protocol
+	if utils.IsIpv6(ipaddr) {
+		family = v1.IPv6Protocol
+	}
+	for _, f := range svc.Spec.IPFamilies {
+		if f == family {
+			return true
 		}
-	case v1.ServiceTypeClusterIP: // "ClusterIP"
+	}
+	return false
+}
+
+// nodePortMembers returns node ip:nodeport members of the address families of the service,
+// if localOnly, only nodes hosting endpoints are included. Nodes without an ip of a family are
+// not members of that family.
+func nodePortMembers(svc *v1.Service, eps *v1.Endpoints, localOnly bool) ([]SvcEpsMember, error) {
+	members := []SvcEpsMember{}
+
+	nodes := NodeCache.All()
+	names := []string{}
+	if localOnly {
 		for _, subset := range eps.Subsets {
-			for _, port := range subset.Ports {
-				for _, addr := range subset.Addresses {
-					member := SvcEpsMember{
-						TargetPort: int(port.Port),
-						IpAddr:     addr.IP,
-					}
-					if addr.NodeName == nil {
-						return []SvcEpsMember{}, fmt.Errorf("%s node name was not appointed in endpoints", addr.IP)
-					}
-					if k8no := NodeCache.Get(*addr.NodeName); k8no == nil {
-						return []SvcEpsMember{}, utils.RetryErrorf("%s not found yet", *addr.NodeName)
-					} else if k8no.NetType == "vxlan" {
-						if utils.IsIpv6(addr.IP) {
-							member.MacAddr = k8no.MacAddrV6
-						} else {
-							member.MacAddr = k8no.MacAddr
-						}
-					}
-					members = append(members, member)
+			for _, addr := range subset.Addresses {
+				if addr.NodeName == nil {
+					return []SvcEpsMember{}, fmt.Errorf("%s node name was not appointed in endpoints", addr.IP)
+				}
+				if _, f := nodes[*addr.NodeName]; !f {
+					return []SvcEpsMember{}, utils.RetryErrorf("%s not found yet", *addr.NodeName)
 				}
+				names = append(names, *addr.NodeName)
 			}
 		}
-	case v1.ServiceTypeLoadBalancer: // "LoadBalancer"
-		return []SvcEpsMember{}, fmt.Errorf("not supported service type: %s", serviceType)
-	case v1.ServiceTypeExternalName: // "ExternalName"
-		return []SvcEpsMember{}, fmt.Errorf("not supported service type: %s", serviceType)
-	default:
-		return []SvcEpsMember{}, fmt.Errorf("unknown service type: %s", serviceType)
+		names = utils.Unified(names)
+	} else {
+		for name := range nodes {
+			names = append(names, name)
+		}
 	}
+	sort.Strings(names)
 
+	families := svc.Spec.IPFamilies
+	if len(families) == 0 {
+		families = []v1.IPFamily{v1.IPv4Protocol}
+	}
+	nodeIPs := []string{}
+	for _, family := range families {
+		for _, name := range names {
+			nd := nodes[name]
+			ipaddr := nd.IpAddr
+			if family == v1.IPv6Protocol {
+				ipaddr = nd.IpAddrV6
+			}
+			// single-stack nodes are skipped for the other family.
+			if ipaddr == "" {
+				continue
+			}
+			nodeIPs = append(nodeIPs, ipaddr)
+		}
+	}
+	if len(nodeIPs) == 0 && len(names) > 0 {
+		return []SvcEpsMember{}, utils.RetryErrorf("no node ip of families %v found yet", families)
+	}
+
+	for _, port := range svc.Spec.Ports {
+		if port.NodePort == 0 {
+			return []SvcEpsMember{}, fmt.Errorf("no nodePort allocated for port %d of service %s",
+				port.Port, utils.Keyname(svc.Namespace, svc.Name))
+		}
+		for _, ip := range nodeIPs {
+			members = append(members, SvcEpsMember{
+				// TargetPort: port.TargetPort.IntValue(),
+				// NodePort:   int(port.NodePort),
+				TargetPort: int(port.NodePort),
+				IpAddr:     ip,
+			})
+		}
+	}
 	return members, nil
 }
 
 func detectCNIType(node *v1.Node) string {
+	if CNIType != "" {
+		return CNIType
+	}
+
 	kind := "unknown"
 
 	for _, c := range node.Status.Conditions {
@@ -89,9 +198,81 @@ func detectCNIType(node *v1.Node) string {
 			break
 		}
 	}
+	if kind != "unknown" {
+		return kind
+	}
+
+	// ovn-kubernetes and antrea do not report node conditions, but annotate the nodes.
+	for k := range node.Annotations {
+		if strings.HasPrefix(k, "k8s.ovn.org/") {
+			return "ovn-kubernetes"
+		}
+		if strings.HasPrefix(k, "node.antrea.io/") {
+			return "antrea"
+		}
+	}
 	return kind
 }
 
+// ValidCNIType returns error if the given CNI type is not empty and not one of SupportedCNITypes.
+func ValidCNIType(cnitype string) error {
+	if cnitype == "" || utils.Contains(SupportedCNITypes, cnitype) {
+		return nil
+	}
+	return fmt.Errorf("unknown CNI type: %s, valid values: %s", cnitype, strings.Join(SupportedCNITypes, ","))
+}
+
+// ovnNodeSubnets parses the default network subnets from annotation k8s.ovn.org/node-subnets,
+// which is in format of {"default":"10.244.0.0/24"} or {"default":["10.244.0.0/24","fd00:10:244:1::/64"]}.
+func ovnNodeSubnets(annotation string) ([]string, error) {
+	var v map[string]interface{}
+	if err := json.Unmarshal([]byte(annotation), &v); err != nil {
+		return []string{}, err
+	}
+	cidrs := []string{}
+	switch d := v["default"].(type) {
+	case string:
+		cidrs = append(cidrs, d)
+	case []interface{}:
+		for _, c := range d {
+			if cidr, ok := c.(string); ok {
+				cidrs = append(cidrs, cidr)
+			}
+		}
+	}
+	return cidrs, nil
+}
+
+// nodeInternalIPs returns the first IPv4 and IPv6 internal addresses of the node.
+func nodeInternalIPs(n *v1.Node) (string, string) {
+	ipv4, ipv6 := "", ""
+	for _, addr := range n.Status.Addresses {
+		if addr.Type != v1.NodeInternalIP {
+			continue
+		}
+		if utils.IsIpv6(addr.Address) {
+			if ipv6 == "" {
+				ipv6 = addr.Address
+			}
+		} else if ipv4 == "" {
+			ipv4 = addr.Address
+		}
+	}
+	return ipv4, ipv6
+}
+
+// Convert an IP string to a fake MAC address, with the last 4 bytes of the address.
+func ipToMac(addr string) string {
+	ip := net.ParseIP(addr)
+	if ip == nil {
+		return ""
+	}
+	if ip4 := ip.To4(); ip4 != nil {
+		return ipv4ToMac(addr)
+	}
+	return fmt.Sprintf("0a:0a:%02x:%02x:%02x:%02x", ip[12], ip[13], ip[14], ip[15])
+}
+
 // Convert an IPV4 string to a fake MAC address.
 func ipv4ToMac(addr string) string {
 	ip := strings.Split(addr, ".")
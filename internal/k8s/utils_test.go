@@ -0,0 +1,229 @@
+package k8s
+
+import (
+	"reflect"
+	"testing"
+
+	v1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+func setupNodes(t *testing.T) {
+	NodeCache = Nodes{
+		Items: map[string]*K8Node{},
+		mutex: make(chan bool, 1),
+	}
+	for _, n := range []K8Node{
+		{Name: "node1", IpAddr: "10.0.0.1", IpAddrV6: "fd00::1", NetType: "vxlan", MacAddr: "aa:aa:aa:aa:aa:01", MacAddrV6: "bb:bb:bb:bb:bb:01"},
+		{Name: "node2", IpAddr: "10.0.0.2", IpAddrV6: "fd00::2", NetType: "vxlan", MacAddr: "aa:aa:aa:aa:aa:02", MacAddrV6: "bb:bb:bb:bb:bb:02"},
+		{Name: "node3", IpAddr: "10.0.0.3", IpAddrV6: "fd00::3", NetType: "vxlan", MacAddr: "aa:aa:aa:aa:aa:03", MacAddrV6: "bb:bb:bb:bb:bb:03"},
+	} {
+		nd := n
+		NodeCache.Items[n.Name] = &nd
+	}
+	t.Cleanup(func() {
+		NodeCache.Items = map[string]*K8Node{}
+	})
+}
+
+func testServiceEndpoints(svcType v1.ServiceType, policy v1.ServiceExternalTrafficPolicy) (*v1.Service, *v1.Endpoints) {
+	node1, node2 := "node1", "node2"
+	svc := v1.Service{
+		ObjectMeta: metav1.ObjectMeta{Namespace: "default", Name: "test"},
+		Spec: v1.ServiceSpec{
+			Type:                  svcType,
+			ExternalTrafficPolicy: policy,
+			Ports:                 []v1.ServicePort{{Port: 80, NodePort: 30080}},
+		},
+	}
+	eps := v1.Endpoints{
+		ObjectMeta: metav1.ObjectMeta{Namespace: "default", Name: "test"},
+		Subsets: []v1.EndpointSubset{
+			{
+				Addresses: []v1.EndpointAddress{
+					{IP: "172.16.1.10", NodeName: &node1},
+					{IP: "172.16.2.10", NodeName: &node2},
+					{IP: "172.16.1.11", NodeName: &node1},
+				},
+				Ports: []v1.EndpointPort{{Port: 8080}},
+			},
+		},
+	}
+	return &svc, &eps
+}
+
+func memberAddrs(mbs []SvcEpsMember) map[string]int {
+	rlt := map[string]int{}
+	for _, mb := range mbs {
+		rlt[mb.IpAddr] = mb.TargetPort
+	}
+	return rlt
+}
+
+func TestFormatMembersFromServiceEndpoints(t *testing.T) {
+	setupNodes(t)
+
+	cases := []struct {
+		name     string
+		svcType  v1.ServiceType
+		policy   v1.ServiceExternalTrafficPolicy
+		mode     string
+		expected map[string]int
+	}{
+		{
+			name:     "auto mode with ClusterIP service",
+			svcType:  v1.ServiceTypeClusterIP,
+			mode:     MemberMode_Auto,
+			expected: map[string]int{"172.16.1.10": 8080, "172.16.2.10": 8080, "172.16.1.11": 8080},
+		},
+		{
+			name:     "auto mode with NodePort service",
+			svcType:  v1.ServiceTypeNodePort,
+			mode:     MemberMode_Auto,
+			expected: map[string]int{"10.0.0.1": 30080, "10.0.0.2": 30080, "10.0.0.3": 30080},
+		},
+		{
+			name:     "cluster mode with NodePort service",
+			svcType:  v1.ServiceTypeNodePort,
+			mode:     MemberMode_Cluster,
+			expected: map[string]int{"172.16.1.10": 8080, "172.16.2.10": 8080, "172.16.1.11": 8080},
+		},
+		{
+			name:     "nodeport mode with LoadBalancer service",
+			svcType:  v1.ServiceTypeLoadBalancer,
+			mode:     MemberMode_NodePort,
+			expected: map[string]int{"10.0.0.1": 30080, "10.0.0.2": 30080, "10.0.0.3": 30080},
+		},
+		{
+			name:     "nodeport mode with externalTrafficPolicy Local",
+			svcType:  v1.ServiceTypeNodePort,
+			policy:   v1.ServiceExternalTrafficPolicyLocal,
+			mode:     MemberMode_NodePort,
+			expected: map[string]int{"10.0.0.1": 30080, "10.0.0.2": 30080},
+		},
+		{
+			name:     "nodeportlocal mode",
+			svcType:  v1.ServiceTypeNodePort,
+			policy:   v1.ServiceExternalTrafficPolicyCluster,
+			mode:     MemberMode_NodePortLocal,
+			expected: map[string]int{"10.0.0.1": 30080, "10.0.0.2": 30080},
+		},
+	}
+
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			svc, eps := testServiceEndpoints(c.svcType, c.policy)
+			mbs, err := FormatMembersFromServiceEndpoints(svc, eps, c.mode)
+			if err != nil {
+				t.Fatalf("unexpected error: %s", err.Error())
+			}
+			addrs := memberAddrs(mbs)
+			if len(addrs) != len(c.expected) || len(mbs) != len(c.expected) {
+				t.Fatalf("expected members %v, got %v", c.expected, mbs)
+			}
+			for ip, port := range c.expected {
+				if addrs[ip] != port {
+					t.Errorf("expected member %s:%d, got %v", ip, port, mbs)
+				}
+			}
+		})
+	}
+
+	t.Run("address families", func(t *testing.T) {
+		node1 := "node1"
+		for _, c := range []struct {
+			name     string
+			svcType  v1.ServiceType
+			families []v1.IPFamily
+			expected map[string]string
+		}{
+			{
+				name:     "dual-stack nodeport",
+				svcType:  v1.ServiceTypeNodePort,
+				families: []v1.IPFamily{v1.IPv6Protocol, v1.IPv4Protocol},
+				expected: map[string]string{
+					"10.0.0.1": "", "10.0.0.2": "", "10.0.0.3": "",
+					"fd00::1": "", "fd00::2": "", "fd00::3": "",
+				},
+			},
+			{
+				name:     "ipv6 nodeport",
+				svcType:  v1.ServiceTypeNodePort,
+				families: []v1.IPFamily{v1.IPv6Protocol},
+				expected: map[string]string{"fd00::1": "", "fd00::2": "", "fd00::3": ""},
+			},
+			{
+				name:     "ipv6 cluster",
+				svcType:  v1.ServiceTypeClusterIP,
+				families: []v1.IPFamily{v1.IPv6Protocol},
+				expected: map[string]string{"fd00:10:244::10": "bb:bb:bb:bb:bb:01"},
+			},
+			{
+				name:     "ipv4 cluster",
+				svcType:  v1.ServiceTypeClusterIP,
+				families: []v1.IPFamily{v1.IPv4Protocol},
+				expected: map[string]string{"172.16.1.10": "aa:aa:aa:aa:aa:01"},
+			},
+		} {
+			svc, eps := testServiceEndpoints(c.svcType, "")
+			svc.Spec.IPFamilies = c.families
+			eps.Subsets[0].Addresses = []v1.EndpointAddress{
+				{IP: "172.16.1.10", NodeName: &node1},
+				{IP: "fd00:10:244::10", NodeName: &node1},
+			}
+			mbs, err := FormatMembersFromServiceEndpoints(svc, eps, MemberMode_Auto)
+			if err != nil {
+				t.Fatalf("%s: unexpected error: %s", c.name, err.Error())
+			}
+			macs := map[string]string{}
+			for _, mb := range mbs {
+				macs[mb.IpAddr] = mb.MacAddr
+			}
+			if !reflect.DeepEqual(macs, c.expected) {
+				t.Errorf("%s: expected members %v, got %v", c.name, c.expected, macs)
+			}
+		}
+	})
+
+	t.Run("single-stack node", func(t *testing.T) {
+		NodeCache.Items["node2"].IpAddrV6 = ""
+		defer func() { NodeCache.Items["node2"].IpAddrV6 = "fd00::2" }()
+		svc, eps := testServiceEndpoints(v1.ServiceTypeNodePort, v1.ServiceExternalTrafficPolicyLocal)
+		svc.Spec.IPFamilies = []v1.IPFamily{v1.IPv4Protocol, v1.IPv6Protocol}
+		mbs, err := FormatMembersFromServiceEndpoints(svc, eps, MemberMode_NodePort)
+		if err != nil {
+			t.Fatalf("unexpected error: %s", err.Error())
+		}
+		expected := map[string]int{"10.0.0.1": 30080, "10.0.0.2": 30080, "fd00::1": 30080}
+		if addrs := memberAddrs(mbs); !reflect.DeepEqual(addrs, expected) {
+			t.Errorf("expected members %v, got %v", expected, addrs)
+		}
+	})
+
+	t.Run("nodeport mode without nodePort", func(t *testing.T) {
+		svc, eps := testServiceEndpoints(v1.ServiceTypeClusterIP, "")
+		svc.Spec.Ports[0].NodePort = 0
+		if _, err := FormatMembersFromServiceEndpoints(svc, eps, MemberMode_NodePort); err == nil {
+			t.Fail()
+		}
+	})
+
+	t.Run("unknown mode", func(t *testing.T) {
+		svc, eps := testServiceEndpoints(v1.ServiceTypeClusterIP, "")
+		if _, err := FormatMembersFromServiceEndpoints(svc, eps, "unknown"); err == nil {
+			t.Fail()
+		}
+	})
+}
+
+func Test_ipToMac(t *testing.T) {
+	for ip, mac := range map[string]string{
+		"10.0.0.1":         "0a:0a:0a:00:00:01",
+		"fd00::a:b0c:d0e0": "0a:0a:0b:0c:d0:e0",
+		"invalid":          "",
+	} {
+		if m := ipToMac(ip); m != mac {
+			t.Errorf("%s: expected %s, got %s", ip, mac, m)
+		}
+	}
+}
@@ -1,5 +1,26 @@
 package k8s
 
+import "k8s.io/apimachinery/pkg/runtime/schema"
+
 var (
 	NodeCache Nodes
+	// CNIType overrides the CNI type detected from nodes if not empty, see SupportedCNITypes.
+	CNIType string
+	// SupportedCNITypes are the CNI types whose node metadata can be extracted.
+	SupportedCNITypes = []string{"cilium", "calico", "flannel", "ovn-kubernetes", "antrea"}
+	// BlockAffinityGVK is the calico IPAM block affinity, telling the pod CIDRs allocated to the nodes.
+	BlockAffinityGVK = schema.GroupVersionKind{Group: "crd.projectcalico.org", Version: "v1", Kind: "BlockAffinity"}
+)
+
+const (
+	// MemberMode_Auto decides pool members by the Service type: node IPs for
+	// NodePort Services and pod IPs for ClusterIP Services.
+	MemberMode_Auto = ""
+	// MemberMode_Cluster uses pod IPs as pool members, for BIG-IPs reachable to the pod network.
+	MemberMode_Cluster = "cluster"
+	// MemberMode_NodePort uses node IPs and NodePorts as pool members, only nodes hosting
+	// endpoints are used when the Service's externalTrafficPolicy is Local.
+	MemberMode_NodePort = "nodeport"
+	// MemberMode_NodePortLocal uses node IPs and NodePorts of nodes hosting endpoints only.
+	MemberMode_NodePortLocal = "nodeportlocal"
 )
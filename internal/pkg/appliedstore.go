@@ -0,0 +1,102 @@
+package pkg
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"regexp"
+	"sync"
+
+	v1 "k8s.io/api/core/v1"
+	k8serrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/types"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+)
+
+// configMapStore persists the hashes of the applied tenants of each BIG-IP in a ConfigMap,
+// one key per BIG-IP, with the value in format of {"<tenant>": "<hash>"}. The tunnel fdb records applied
+// to the BIG-IP are kept in the same way, see persistFdbs.
+type configMapStore struct {
+	reader    client.Reader
+	writer    client.Writer
+	namespace string
+	name      string
+	mutex     sync.Mutex
+}
+
+var invalidKeyChars = regexp.MustCompile(`[^-._a-zA-Z0-9]+`)
+
+// SetupAppliedStore enables persisting the applied tenants in the ConfigMap namespace/name.
+// reader should be an uncached one, since it's used before the manager starts.
+func SetupAppliedStore(reader client.Reader, writer client.Writer, namespace, name string) {
+	appliedStore = &configMapStore{
+		reader:    reader,
+		writer:    writer,
+		namespace: namespace,
+		name:      name,
+		mutex:     sync.Mutex{},
+	}
+}
+
+func (s *configMapStore) load(ctx context.Context) (map[string]map[string]string, error) {
+	rlt := map[string]map[string]string{}
+	var cm v1.ConfigMap
+	if err := s.reader.Get(ctx, types.NamespacedName{Namespace: s.namespace, Name: s.name}, &cm); err != nil {
+		return rlt, client.IgnoreNotFound(err)
+	}
+	for k, v := range cm.Data {
+		hashes := map[string]string{}
+		if err := json.Unmarshal([]byte(v), &hashes); err != nil {
+			return rlt, fmt.Errorf("invalid applied tenants of %s: %s", k, err.Error())
+		}
+		rlt[k] = hashes
+	}
+	return rlt, nil
+}
+
+func (s *configMapStore) loadFor(ctx context.Context, url string) (map[string]string, error) {
+	all, err := s.load(ctx)
+	if err != nil {
+		return map[string]string{}, err
+	}
+	if hashes, f := all[storeKey(url)]; f {
+		return hashes, nil
+	}
+	return map[string]string{}, nil
+}
+
+func (s *configMapStore) save(ctx context.Context, url string, hashes map[string]string) error {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	b, err := json.Marshal(hashes)
+	if err != nil {
+		return err
+	}
+
+	var cm v1.ConfigMap
+	err = s.reader.Get(ctx, types.NamespacedName{Namespace: s.namespace, Name: s.name}, &cm)
+	if k8serrors.IsNotFound(err) {
+		cm = v1.ConfigMap{
+			ObjectMeta: metav1.ObjectMeta{Namespace: s.namespace, Name: s.name},
+			Data:       map[string]string{storeKey(url): string(b)},
+		}
+		return s.writer.Create(ctx, &cm)
+	} else if err != nil {
+		return err
+	}
+	if cm.Data == nil {
+		cm.Data = map[string]string{}
+	}
+	if cm.Data[storeKey(url)] == string(b) {
+		return nil
+	}
+	cm.Data[storeKey(url)] = string(b)
+	return s.writer.Update(ctx, &cm)
+}
+
+// storeKey converts the BIG-IP url to a valid ConfigMap key.
+func storeKey(url string) string {
+	return invalidKeyChars.ReplaceAllString(url, "_")
+}
@@ -0,0 +1,59 @@
+package pkg
+
+import (
+	"context"
+	"reflect"
+	"testing"
+
+	"github.com/f5devcentral/f5-bigip-rest-go/deployer"
+	"sigs.k8s.io/controller-runtime/pkg/client/fake"
+)
+
+func Test_configMapStore(t *testing.T) {
+	cli := fake.NewClientBuilder().Build()
+	s := &configMapStore{reader: cli, writer: cli, namespace: "kube-system", name: "applied"}
+	ctx := context.TODO()
+
+	if hashes, err := s.loadFor(ctx, "https://10.250.15.180:443"); err != nil || len(hashes) != 0 {
+		t.Fatalf("expected nothing loaded, got %v, %v", hashes, err)
+	}
+
+	bip1 := map[string]string{"gwc1": "hash1", "default": "hash2"}
+	bip2 := map[string]string{"gwc1": "hash3"}
+	if err := s.save(ctx, "https://10.250.15.180:443", bip1); err != nil {
+		t.Fatalf("failed to save: %s", err.Error())
+	}
+	if err := s.save(ctx, "https://10.250.15.181", bip2); err != nil {
+		t.Fatalf("failed to save: %s", err.Error())
+	}
+
+	all, err := s.load(ctx)
+	if err != nil {
+		t.Fatalf("failed to load: %s", err.Error())
+	}
+	expected := map[string]map[string]string{
+		"https_10.250.15.180_443": bip1,
+		"https_10.250.15.181":     bip2,
+	}
+	if !reflect.DeepEqual(all, expected) {
+		t.Errorf("expected %v, got %v", expected, all)
+	}
+}
+
+func Test_bigipWorker_appliedTenants(t *testing.T) {
+	as3 := RestToAS3(map[string]interface{}{"gwc1": map[string]interface{}{}})
+	tenant := as3["declaration"].(map[string]interface{})["gwc1"]
+	w := newBIGIPWorker(nil)
+	// loaded from store after restart, but not desired yet
+	w.applied = map[string]string{"gwc1": tenantHash(tenant)}
+	if tenants := w.appliedTenants(); len(tenants) != 0 {
+		t.Errorf("expected no applied tenant, got %v", tenants)
+	}
+
+	if tenants := w.tenantsToDeploy([]deployer.DeployRequest{{To: &as3, AS3: true}}); len(tenants) != 0 {
+		t.Errorf("expected unchanged tenant not deployed after restart, got %v", tenants)
+	}
+	if tenants := w.appliedTenants(); len(tenants) != 1 {
+		t.Errorf("expected 1 applied tenant, got %v", tenants)
+	}
+}
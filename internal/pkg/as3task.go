@@ -0,0 +1,213 @@
+package pkg
+
+import (
+	"context"
+	"crypto/tls"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"time"
+
+	"github.com/f5devcentral/f5-bigip-rest-go/utils"
+)
+
+// as3Client submits AS3 declarations in async mode and polls the task results.
+type as3Client struct {
+	url           string
+	authorization string
+	client        *http.Client
+	// superseded tells if the task of the given tenants is outdated by the pending requests.
+	superseded func(tenants []string) bool
+}
+
+type as3TaskResult struct {
+	Code    int    `json:"code"`
+	Message string `json:"message"`
+	Tenant  string `json:"tenant"`
+	// Response is the detailed error message of a failed tenant.
+	Response string `json:"response"`
+}
+
+type as3TaskResponse struct {
+	ID      string          `json:"id"`
+	Results []as3TaskResult `json:"results"`
+}
+
+var errSuperseded = fmt.Errorf("superseded by the pending requests")
+
+var errTaskTimeout = errors.New("timeout")
+
+// as3Error is the failure responded by AS3, Code is the HTTP status code or the code of the task result.
+// Only Code and Message, but not the detail which may echo the declaration, tell if it's transient.
+type as3Error struct {
+	Code    int
+	Message string
+	detail  string
+}
+
+func (e *as3Error) Error() string {
+	return fmt.Sprintf("%d, %s", e.Code, e.detail)
+}
+
+func newAS3Client(url, authorization string) *as3Client {
+	return &as3Client{
+		url:           url,
+		authorization: authorization,
+		client: &http.Client{
+			Transport: &http.Transport{
+				TLSClientConfig: &tls.Config{
+					InsecureSkipVerify: true,
+				},
+			},
+			Timeout: 60 * time.Second,
+		},
+		superseded: func(tenants []string) bool { return false },
+	}
+}
+
+// deploy submits the declaration as an async task, and polls it until done, superseded or timeout.
+// It returns the results per tenant.
+func (ac *as3Client) deploy(ctx context.Context, as3body map[string]interface{}, tenants []string) map[string]error {
+	defer utils.TimeItToPrometheus()()
+	slog := utils.LogFromContext(ctx)
+
+	results := map[string]error{}
+	setAll := func(err error) map[string]error {
+		for _, tn := range tenants {
+			results[tn] = err
+		}
+		return results
+	}
+
+	id, err := ac.submit(as3body)
+	if err != nil {
+		return setAll(fmt.Errorf("failed to do deployment to %s: %w", ac.url, err))
+	}
+	slog.Debugf("submitted AS3 task %s to %s for tenants %s", id, ac.url, tenants)
+
+	deadline := time.Now().Add(AS3TaskTimeout)
+	for {
+		<-time.After(as3PollInterval)
+
+		trs, err := ac.task(id)
+		if err != nil {
+			slog.Warnf("failed to poll AS3 task %s: %s", id, err.Error())
+		} else if !taskInProgress(trs) {
+			for _, tn := range tenants {
+				results[tn] = nil
+			}
+			for _, tr := range trs {
+				var e error
+				if tr.Code != http.StatusOK {
+					e = fmt.Errorf("failed to do deployment to %s: %w", ac.url, &as3Error{
+						Code:    tr.Code,
+						Message: tr.Message,
+						detail:  RedactText(tr.Message) + " " + RedactText(tr.Response),
+					})
+				}
+				if tr.Tenant == "" {
+					if e != nil {
+						setAll(e)
+					}
+				} else if _, f := results[tr.Tenant]; f {
+					results[tr.Tenant] = e
+				}
+			}
+			return results
+		}
+
+		if ac.superseded(tenants) {
+			slog.Infof("AS3 task %s on %s is superseded, stop polling", id, ac.url)
+			return setAll(errSuperseded)
+		}
+		if time.Now().After(deadline) {
+			return setAll(fmt.Errorf("AS3 task %s on %s %w after %s", id, ac.url, errTaskTimeout, AS3TaskTimeout))
+		}
+	}
+}
+
+func (ac *as3Client) submit(as3body map[string]interface{}) (string, error) {
+	b, err := json.Marshal(as3body)
+	if err != nil {
+		return "", err
+	}
+	code, resp, err := utils.HttpRequest(ac.client, ac.url+"/mgmt/shared/appsvcs/declare?async=true", "POST", string(b), ac.headers())
+	if err != nil {
+		return "", err
+	}
+	if code != http.StatusAccepted {
+		var r as3TaskResult
+		json.Unmarshal(resp, &r)
+		return "", &as3Error{Code: code, Message: r.Message, detail: RedactText(string(resp))}
+	}
+	var tr as3TaskResponse
+	if err := json.Unmarshal(resp, &tr); err != nil {
+		return "", err
+	}
+	if tr.ID == "" {
+		return "", fmt.Errorf("no task id in response: %s", RedactText(string(resp)))
+	}
+	return tr.ID, nil
+}
+
+func (ac *as3Client) task(id string) ([]as3TaskResult, error) {
+	code, resp, err := utils.HttpRequest(ac.client, ac.url+"/mgmt/shared/appsvcs/task/"+id, "GET", "", ac.headers())
+	if err != nil {
+		return nil, err
+	}
+	if code != http.StatusOK {
+		return nil, fmt.Errorf("%d, %s", code, RedactText(string(resp)))
+	}
+	var tr as3TaskResponse
+	if err := json.Unmarshal(resp, &tr); err != nil {
+		return nil, err
+	}
+	return tr.Results, nil
+}
+
+// declaration returns the current AS3 declaration on BIG-IP, with tenants as the keys.
+func (ac *as3Client) declaration() (map[string]interface{}, error) {
+	code, resp, err := utils.HttpRequest(ac.client, ac.url+"/mgmt/shared/appsvcs/declare", "GET", "", ac.headers())
+	if err != nil {
+		return nil, err
+	}
+	switch code {
+	case http.StatusNoContent:
+		return map[string]interface{}{}, nil
+	case http.StatusOK:
+		decl := map[string]interface{}{}
+		if err := json.Unmarshal(resp, &decl); err != nil {
+			return nil, err
+		}
+		return decl, nil
+	default:
+		return nil, fmt.Errorf("%d, %s", code, RedactText(string(resp)))
+	}
+}
+
+// LiveDeclaration returns the current AS3 declaration on the BIG-IP of url, with tenants as the keys.
+func LiveDeclaration(url, username, password string) (map[string]interface{}, error) {
+	authorization := "Basic " + base64.StdEncoding.EncodeToString([]byte(username+":"+password))
+	return newAS3Client(url, authorization).declaration()
+}
+
+func (ac *as3Client) headers() map[string]string {
+	return map[string]string{
+		"Content-Type":  "application/json",
+		"Authorization": ac.authorization,
+	}
+}
+
+func taskInProgress(results []as3TaskResult) bool {
+	if len(results) == 0 {
+		return true
+	}
+	for _, r := range results {
+		if r.Message == "in progress" || r.Message == "pending" {
+			return true
+		}
+	}
+	return false
+}
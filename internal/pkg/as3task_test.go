@@ -0,0 +1,58 @@
+package pkg
+
+import (
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+func Test_as3Client_deploy(t *testing.T) {
+	polls := 0
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/mgmt/shared/appsvcs/declare":
+			if r.URL.Query().Get("async") != "true" {
+				t.Errorf("expected async submission")
+			}
+			w.WriteHeader(http.StatusAccepted)
+			fmt.Fprint(w, `{"id": "task1", "results": [{"message": "Declaration successfully submitted", "code": 0}]}`)
+		case "/mgmt/shared/appsvcs/task/task1":
+			polls++
+			if polls < 2 {
+				fmt.Fprint(w, `{"id": "task1", "results": [{"message": "in progress", "code": 0}]}`)
+			} else {
+				fmt.Fprint(w, `{"id": "task1", "results": [
+					{"message": "success", "tenant": "a", "code": 200},
+					{"message": "declaration failed", "tenant": "b", "code": 422, "response": "/b/serviceMain/busy-app: in progress, try again is invalid"}
+				]}`)
+			}
+		default:
+			w.WriteHeader(http.StatusNotFound)
+		}
+	}))
+	defer server.Close()
+
+	as3PollInterval = 10 * time.Millisecond
+	defer func() { as3PollInterval = time.Second }()
+
+	ac := newAS3Client(server.URL, "")
+	results := ac.deploy(NewContext(), RestToAS3(map[string]interface{}{}), []string{"a", "b"})
+	if polls != 2 {
+		t.Errorf("expected 2 polls, got %d", polls)
+	}
+	if results["a"] != nil {
+		t.Errorf("expected tenant a succeeded, got %s", results["a"])
+	}
+	if results["b"] == nil || isTransient(results["b"]) {
+		t.Errorf("expected tenant b failed permanently, got %v", results["b"])
+	}
+
+	polls = 0
+	ac.superseded = func(tenants []string) bool { return true }
+	results = ac.deploy(NewContext(), RestToAS3(map[string]interface{}{}), []string{"a"})
+	if results["a"] != errSuperseded {
+		t.Errorf("expected tenant a superseded, got %v", results["a"])
+	}
+}
@@ -17,7 +17,9 @@ import (
 	gatewayapi "sigs.k8s.io/gateway-api/apis/v1"
 	gatewayv1beta1 "sigs.k8s.io/gateway-api/apis/v1beta1"
 
+	"k8s.io/apimachinery/pkg/api/meta"
 	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
 )
 
 func (c *SIGCache) SetNamespace(obj *v1.Namespace) {
@@ -71,7 +73,7 @@ func (c *SIGCache) SetGateway(obj *gatewayapi.Gateway) {
 	defer c.mutex.Unlock()
 
 	if obj != nil {
-		c.Gateway[utils.Keyname(obj.Namespace, obj.Name)] = obj
+		c._setGateway(obj)
 	}
 }
 
@@ -79,7 +81,7 @@ func (c *SIGCache) UnsetGateway(keyname string) {
 	c.mutex.Lock()
 	defer c.mutex.Unlock()
 
-	delete(c.Gateway, keyname)
+	c._unsetGateway(keyname)
 }
 
 func (c *SIGCache) GetGateway(keyname string) *gatewayapi.Gateway {
@@ -94,7 +96,7 @@ func (c *SIGCache) SetHTTPRoute(obj *gatewayapi.HTTPRoute) {
 	defer c.mutex.Unlock()
 
 	if obj != nil {
-		c.HTTPRoute[utils.Keyname(obj.Namespace, obj.Name)] = obj
+		c._setHTTPRoute(obj)
 	}
 }
 
@@ -102,7 +104,7 @@ func (c *SIGCache) UnsetHTTPRoute(keyname string) {
 	c.mutex.Lock()
 	defer c.mutex.Unlock()
 
-	delete(c.HTTPRoute, keyname)
+	c._unsetHTTPRoute(keyname)
 }
 
 func (c *SIGCache) GetHTTPRoute(keyname string) *gatewayapi.HTTPRoute {
@@ -241,8 +243,8 @@ func (c *SIGCache) _attachedGateways(gwc *gatewayapi.GatewayClass) []*gatewayapi
 	}
 
 	gws := []*gatewayapi.Gateway{}
-	for _, gw := range c.Gateway {
-		if gw.Spec.GatewayClassName == gatewayapi.ObjectName(gwc.Name) {
+	for _, k := range c._lookup(func(ix *sigIndexes) *refIndex { return ix.classGateways }, gwc.Name) {
+		if gw, ok := c.Gateway[k]; ok {
 			gws = append(gws, gw)
 		}
 	}
@@ -272,12 +274,9 @@ func (c *SIGCache) _gatewayRefsOfHR(hr *gatewayapi.HTTPRoute) []*gatewayapi.Gate
 		}
 		name := utils.Keyname(utils.Keyname(ns, string(pr.Name)))
 		if gw, ok := c.Gateway[name]; ok {
-			for _, listener := range gw.Spec.Listeners {
-				if listener.Name != *pr.SectionName {
-					continue
-				}
+			for _, listener := range parentListeners(gw, hr, &pr) {
 				routetype := reflect.TypeOf(*hr).Name()
-				if RouteMatches(gw.Namespace, &listener, c.Namespace[hr.Namespace], routetype) {
+				if RouteMatches(gw.Namespace, listener, c.Namespace[hr.Namespace], routetype) {
 					gws = append(gws, gw)
 					break
 				}
@@ -299,7 +298,11 @@ func (c *SIGCache) GatewayRefsOfSecret(scrt *v1.Secret) ([]*gatewayapi.Gateway,
 	}
 	gws := []*gatewayapi.Gateway{}
 
-	for _, gw := range c.Gateway {
+	for _, k := range c._lookup(func(ix *sigIndexes) *refIndex { return ix.secretGateways }, utils.Keyname(scrt.Namespace, scrt.Name)) {
+		gw, ok := c.Gateway[k]
+		if !ok {
+			continue
+		}
 		for i, found := 0, false; i < len(gw.Spec.Listeners) && !found; i++ {
 			listener := gw.Spec.Listeners[i]
 			if listener.Protocol == gatewayapi.HTTPSProtocolType {
@@ -391,31 +394,31 @@ func (c *SIGCache) _attachedHTTPRoutes(gw *gatewayapi.Gateway) []*gatewayapi.HTT
 		return []*gatewayapi.HTTPRoute{}
 	}
 
-	listeners := map[string]*gatewayapi.Listener{}
-	for _, ls := range gw.Spec.Listeners {
-		lskey := gwListenerName(gw, &ls)
-		listeners[lskey] = ls.DeepCopy()
+	hrs := []*gatewayapi.HTTPRoute{}
+	for _, k := range c._lookup(func(ix *sigIndexes) *refIndex { return ix.gatewayRoutes }, utils.Keyname(gw.Namespace, gw.Name)) {
+		hr, ok := c.HTTPRoute[k]
+		if !ok {
+			continue
+		}
+		if c._routeAttached(gw, hr) {
+			hrs = append(hrs, hr)
+		}
 	}
+	return hrs
+}
 
-	hrs := []*gatewayapi.HTTPRoute{}
-	for _, hr := range c.HTTPRoute {
-		for _, pr := range hr.Spec.ParentRefs {
-			ns := hr.Namespace
-			if pr.Namespace != nil {
-				ns = string(*pr.Namespace)
-			}
-			if utils.Keyname(ns, string(pr.Name)) == utils.Keyname(gw.Namespace, gw.Name) {
-				vsname := hrParentName(hr, &pr)
-				routeNamespace := c.Namespace[hr.Namespace]
-				routetype := reflect.TypeOf(*hr).Name()
-				if RouteMatches(gw.Namespace, listeners[vsname], routeNamespace, routetype) {
-					hrs = append(hrs, hr)
-					break
-				}
+// _routeAttached tells whether the route attaches to any listener of the Gateway.
+func (c *SIGCache) _routeAttached(gw *gatewayapi.Gateway, hr *gatewayapi.HTTPRoute) bool {
+	routeNamespace := c.Namespace[hr.Namespace]
+	routetype := reflect.TypeOf(*hr).Name()
+	for _, pr := range hr.Spec.ParentRefs {
+		for _, ls := range parentListeners(gw, hr, &pr) {
+			if RouteMatches(gw.Namespace, ls, routeNamespace, routetype) {
+				return true
 			}
 		}
 	}
-	return hrs
+	return false
 }
 
 func (c *SIGCache) AttachedServices(hr *gatewayapi.HTTPRoute) []*v1.Service {
@@ -459,27 +462,53 @@ func (c *SIGCache) _attachedServices(hr *gatewayapi.HTTPRoute) []*v1.Service {
 	return svcs
 }
 
-// func (c *SIGCache) AllAttachedServiceKeys() []string {
-// 	defer utils.TimeItToPrometheus()()
+// AllAttachedServiceKeys returns keys of all the services referred by the gateway classes.
+func (c *SIGCache) AllAttachedServiceKeys() []string {
+	defer utils.TimeItToPrometheus()()
+
+	c.mutex.RLock()
+	defer c.mutex.RUnlock()
+
+	svcs := []*v1.Service{}
+	for _, gwc := range c.GatewayClass {
+		for _, gw := range c._attachedGateways(gwc) {
+			for _, hr := range c._attachedHTTPRoutes(gw) {
+				svcs = append(svcs, c._attachedServices(hr)...)
+			}
+		}
+	}
+
+	rlt := []string{}
+	for _, svc := range svcs {
+		rlt = append(rlt, utils.Keyname(svc.Namespace, svc.Name))
+	}
+	return utils.Unified(rlt)
+}
 
-// 	c.mutex.RLock()
-// 	defer c.mutex.RUnlock()
+// ManagedTenants returns the names of the tenants expected by the gateway classes of this controller,
+// that is, the gateway classes and the namespaces of their referred services, with TenantPrefix.
+func (c *SIGCache) ManagedTenants() []string {
+	defer utils.TimeItToPrometheus()()
 
-// 	svcs := []*v1.Service{}
-// 	for _, gwc := range c.GatewayClass {
-// 		for _, gw := range c._attachedGateways(gwc) {
-// 			for _, hr := range c._attachedHTTPRoutes(gw) {
-// 				svcs = append(svcs, c._attachedServices(hr)...)
-// 			}
-// 		}
-// 	}
+	c.mutex.RLock()
+	defer c.mutex.RUnlock()
 
-// 	rlt := []string{}
-// 	for _, svc := range svcs {
-// 		rlt = append(rlt, utils.Keyname(svc.Namespace, svc.Name))
-// 	}
-// 	return rlt
-// }
+	rlt := []string{}
+	for _, gwc := range c.GatewayClass {
+		if gwc.Spec.ControllerName != gatewayapi.GatewayController(c.ControllerName) {
+			continue
+		}
+		rlt = append(rlt, tenantName(gwc.Name))
+		for _, gw := range c._attachedGateways(gwc) {
+			for _, hr := range c._attachedHTTPRoutes(gw) {
+				for _, svc := range c._attachedServices(hr) {
+					rlt = append(rlt, tenantName(svc.Namespace))
+				}
+			}
+		}
+	}
+	return utils.Unified(rlt)
+}
 
 func (c *SIGCache) RelatedServices(gwc *gatewayapi.GatewayClass) []*v1.Service {
 	defer utils.TimeItToPrometheus()()
@@ -524,37 +553,13 @@ func (c *SIGCache) _HTTPRoutesRefsOf(svc *v1.Service) []*gatewayapi.HTTPRoute {
 		return []*gatewayapi.HTTPRoute{}
 	}
 
-	// To performance perspective, it may be good.
-	// But the implementation is similiar to _attachedServices, would easily introduce issues.
-	// refered := func(hr *gatewayapi.HTTPRoute) bool {
-	// 	for _, rl := range hr.Spec.Rules {
-	// 		for _, br := range rl.BackendRefs {
-	// 			ns := hr.Namespace
-	// 			if br.Namespace != nil {
-	// 				ns = string(*br.Namespace)
-	// 			}
-	// 			if utils.Keyname(ns, string(br.Name)) == utils.Keyname(svc.Namespace, svc.Name) {
-	// 				return true
-	// 			}
-	// 		}
-	// 	}
-	// 	for _, rl := range hr.Spec.Rules {
-	// 		for _, fl := range rl.Filters {
-	// 			if fl.Type == gatewayapi.HTTPRouteFilterExtensionRef && fl.ExtensionRef != nil {
-	// 				er := fl.ExtensionRef
-	// 				if er.Group == "" && er.Kind == "Service" {
-	// 					if utils.Keyname(hr.Namespace, string(er.Name)) == utils.Keyname(svc.Namespace, svc.Name) {
-	// 						return true
-	// 					}
-	// 				}
-	// 			}
-	// 		}
-	// 	}
-	// 	return false
-	// }
-
+	// the indexed routes are the candidates, whether they can refer to the service is checked by _attachedServices.
 	hrKeys := []string{}
-	for _, hr := range c.HTTPRoute {
+	for _, k := range c._lookup(func(ix *sigIndexes) *refIndex { return ix.serviceRoutes }, utils.Keyname(svc.Namespace, svc.Name)) {
+		hr, ok := c.HTTPRoute[k]
+		if !ok {
+			continue
+		}
 		svcs := c._attachedServices(hr)
 		svcKeys := []string{}
 		for _, s := range svcs {
@@ -652,17 +657,14 @@ func (c *SIGCache) NSImpactedGatewayClasses(ns *v1.Namespace) []string {
 	}
 
 	names := []string{}
-	for _, hr := range c.HTTPRoute {
-		if hr.Namespace == ns.Name {
-			for _, pr := range hr.Spec.ParentRefs {
-				ns := hr.Namespace
-				if pr.Namespace != nil {
-					ns = string(*pr.Namespace)
-				}
-				name := utils.Keyname(utils.Keyname(ns, string(pr.Name)))
-				if gw, ok := c.Gateway[name]; ok {
-					names = append(names, string(gw.Spec.GatewayClassName))
-				}
+	for _, k := range c._lookup(func(ix *sigIndexes) *refIndex { return ix.namespaceRoutes }, ns.Name) {
+		hr, ok := c.HTTPRoute[k]
+		if !ok {
+			continue
+		}
+		for _, name := range routeParentKeys(hr) {
+			if gw, ok := c.Gateway[name]; ok {
+				names = append(names, string(gw.Spec.GatewayClassName))
 			}
 		}
 	}
@@ -681,8 +683,8 @@ func (c *SIGCache) _rgImpactedGateways(rg *gatewayv1beta1.ReferenceGrant) []*gat
 	for _, f := range rg.Spec.From {
 		if gatewayapi.GroupName == f.Group &&
 			reflect.TypeOf(gatewayapi.Gateway{}).Name() == string(f.Kind) {
-			for _, gw := range c.Gateway {
-				if gw.Namespace == string(f.Namespace) {
+			for _, k := range c._lookup(func(ix *sigIndexes) *refIndex { return ix.namespaceGateways }, string(f.Namespace)) {
+				if gw, ok := c.Gateway[k]; ok {
 					rlt = append(rlt, gw)
 				}
 			}
@@ -703,8 +705,8 @@ func (c *SIGCache) _rgImpactedHTTPRoutes(rg *gatewayv1beta1.ReferenceGrant) []*g
 	for _, f := range rg.Spec.From {
 		if gatewayapi.GroupName == f.Group &&
 			reflect.TypeOf(gatewayapi.HTTPRoute{}).Name() == string(f.Kind) {
-			for _, hr := range c.HTTPRoute {
-				if hr.Namespace == string(f.Namespace) {
+			for _, k := range c._lookup(func(ix *sigIndexes) *refIndex { return ix.namespaceRoutes }, string(f.Namespace)) {
+				if hr, ok := c.HTTPRoute[k]; ok {
 					rlt = append(rlt, hr)
 				}
 			}
@@ -765,27 +767,29 @@ func (c *SIGCache) syncCoreV1Resources(mgr manager.Manager) error {
 		return fmt.Errorf("unable to create kubeclient: %s", err.Error())
 	}
 
-	if epsList, err := kubeClient.CoreV1().Endpoints(v1.NamespaceAll).List(context.TODO(), metav1.ListOptions{}); err != nil {
-		return err
-	} else {
-		for _, eps := range epsList.Items {
-			slog.Debugf("found eps %s", utils.Keyname(eps.Namespace, eps.Name))
-			c.Endpoints[utils.Keyname(eps.Namespace, eps.Name)] = eps.DeepCopy()
+	for _, watched := range WatchedNamespaces() {
+		if epsList, err := kubeClient.CoreV1().Endpoints(watched).List(context.TODO(), metav1.ListOptions{}); err != nil {
+			return err
+		} else {
+			for _, eps := range epsList.Items {
+				slog.Debugf("found eps %s", utils.Keyname(eps.Namespace, eps.Name))
+				c.Endpoints[utils.Keyname(eps.Namespace, eps.Name)] = eps.DeepCopy()
+			}
 		}
-	}
 
-	if svcList, err := kubeClient.CoreV1().Services(v1.NamespaceAll).List(context.TODO(), metav1.ListOptions{}); err != nil {
-		return err
-	} else {
-		for _, svc := range svcList.Items {
-			slog.Debugf("found svc %s", utils.Keyname(svc.Namespace, svc.Name))
-			// listed services has no TypeMeta set, complement it for referenceGrant check.
-			typed := svc.DeepCopy()
-			typed.TypeMeta = metav1.TypeMeta{
-				APIVersion: v1.SchemeGroupVersion.Version,
-				Kind:       reflect.TypeOf(svc).Name(),
+		if svcList, err := kubeClient.CoreV1().Services(watched).List(context.TODO(), metav1.ListOptions{}); err != nil {
+			return err
+		} else {
+			for _, svc := range svcList.Items {
+				slog.Debugf("found svc %s", utils.Keyname(svc.Namespace, svc.Name))
+				// listed services has no TypeMeta set, complement it for referenceGrant check.
+				typed := svc.DeepCopy()
+				typed.TypeMeta = metav1.TypeMeta{
+					APIVersion: v1.SchemeGroupVersion.Version,
+					Kind:       reflect.TypeOf(svc).Name(),
+				}
+				c.Service[utils.Keyname(svc.Namespace, svc.Name)] = typed
 			}
-			c.Service[utils.Keyname(svc.Namespace, svc.Name)] = typed
 		}
 	}
 
@@ -808,18 +812,17 @@ func (c *SIGCache) syncCoreV1Resources(mgr manager.Manager) error {
 		}
 	}
 
-	if secList, err := kubeClient.CoreV1().Secrets(v1.NamespaceAll).List(context.TODO(), metav1.ListOptions{}); err != nil {
-		return err
+	// the calico IPAM blocks, if calico is installed.
+	blocks := &unstructured.UnstructuredList{}
+	blocks.SetGroupVersionKind(k8s.BlockAffinityGVK.GroupVersion().WithKind(k8s.BlockAffinityGVK.Kind + "List"))
+	if err := mgr.GetAPIReader().List(context.TODO(), blocks); err != nil {
+		if !meta.IsNoMatchError(err) {
+			return err
+		}
 	} else {
-		for _, scrt := range secList.Items {
-			slog.Debugf("found secret %s", scrt.Name)
-			// listed secrets has no TypeMeta set, complement it for referenceGrant check.
-			typed := scrt.DeepCopy()
-			typed.TypeMeta = metav1.TypeMeta{
-				APIVersion: v1.SchemeGroupVersion.Version,
-				Kind:       reflect.TypeOf(scrt).Name(),
-			}
-			c.Secret[utils.Keyname(scrt.Namespace, scrt.Name)] = typed
+		for i := range blocks.Items {
+			slog.Debugf("found blockaffinity %s", blocks.Items[i].GetName())
+			k8s.NodeCache.SetBlockAffinity(&blocks.Items[i])
 		}
 	}
 
@@ -877,7 +880,7 @@ func (c *SIGCache) syncGatewayResources(mgr manager.Manager) error {
 	} else {
 		for _, gw := range gtwList.Items {
 			slog.Debugf("found gateway %s", utils.Keyname(gw.Namespace, gw.Name))
-			c.Gateway[utils.Keyname(gw.Namespace, gw.Name)] = gw.DeepCopy()
+			c._setGateway(gw.DeepCopy())
 		}
 	}
 
@@ -886,7 +889,7 @@ func (c *SIGCache) syncGatewayResources(mgr manager.Manager) error {
 	} else {
 		for _, hr := range hrList.Items {
 			slog.Debugf("found httproute %s", utils.Keyname(hr.Namespace, hr.Name))
-			c.HTTPRoute[utils.Keyname(hr.Namespace, hr.Name)] = hr.DeepCopy()
+			c._setHTTPRoute(hr.DeepCopy())
 		}
 	}
 
@@ -915,7 +918,12 @@ func (c *SIGCache) SyncAllResources(mgr manager.Manager) {
 	if err := c.syncGatewayResources(mgr); err != nil {
 		slog.Errorf("failed to sync gateway api resources to local: %s", err.Error())
 	}
+	// only the secrets referenced by the gateways are cached.
+	if err := c._syncReferencedSecrets(context.TODO(), mgr.GetAPIReader()); err != nil {
+		slog.Errorf("failed to sync referenced secrets to local: %s", err.Error())
+	}
 
 	slog.Infof("Finished syncing resources to local")
 	c.SyncedAtStart = true
+	RequestNetSync()
 }
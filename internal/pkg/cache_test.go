@@ -1,6 +1,7 @@
 package pkg
 
 import (
+	"fmt"
 	"reflect"
 	"sync"
 	"testing"
@@ -84,3 +85,123 @@ func TestSIGCache_SetGetExist(t *testing.T) {
 		t.Fail()
 	}
 }
+
+// benchmarkCache returns a cache of n httproutes, attached evenly to n/10 gateways of one gateway class,
+// each route referring to its own service and each gateway to its own secret.
+func benchmarkCache(n int) *SIGCache {
+	c := &SIGCache{
+		mutex:          sync.RWMutex{},
+		Gateway:        map[string]*gatewayapi.Gateway{},
+		HTTPRoute:      map[string]*gatewayapi.HTTPRoute{},
+		Endpoints:      map[string]*v1.Endpoints{},
+		Service:        map[string]*v1.Service{},
+		GatewayClass:   map[string]*gatewayapi.GatewayClass{},
+		Namespace:      map[string]*v1.Namespace{},
+		ReferenceGrant: map[string]*gatewayv1beta1.ReferenceGrant{},
+		Secret:         map[string]*v1.Secret{},
+	}
+	from := gatewayapi.NamespacesFromSame
+	c.SetGatewayClass(&gatewayapi.GatewayClass{ObjectMeta: metav1.ObjectMeta{Name: "gwc"}})
+	for i := 0; i < n/10; i++ {
+		ns := fmt.Sprintf("ns%d", i%10)
+		c.SetNamespace(&v1.Namespace{ObjectMeta: metav1.ObjectMeta{Name: ns}})
+		c.SetSecret(&v1.Secret{
+			TypeMeta:   metav1.TypeMeta{APIVersion: "v1", Kind: "Secret"},
+			ObjectMeta: metav1.ObjectMeta{Namespace: ns, Name: fmt.Sprintf("scrt%d", i)},
+		})
+		c.SetGateway(&gatewayapi.Gateway{
+			ObjectMeta: metav1.ObjectMeta{Namespace: ns, Name: fmt.Sprintf("gw%d", i)},
+			Spec: gatewayapi.GatewaySpec{
+				GatewayClassName: "gwc",
+				Listeners: []gatewayapi.Listener{{
+					Name:          "https",
+					Protocol:      gatewayapi.HTTPSProtocolType,
+					AllowedRoutes: &gatewayapi.AllowedRoutes{Namespaces: &gatewayapi.RouteNamespaces{From: &from}},
+					TLS: &gatewayapi.GatewayTLSConfig{
+						CertificateRefs: []gatewayapi.SecretObjectReference{{Name: gatewayapi.ObjectName(fmt.Sprintf("scrt%d", i))}},
+					},
+				}},
+			},
+		})
+	}
+	for i := 0; i < n; i++ {
+		ns, sn := fmt.Sprintf("ns%d", i%10), gatewayapi.SectionName("https")
+		c.SetService(&v1.Service{
+			TypeMeta:   metav1.TypeMeta{APIVersion: "v1", Kind: "Service"},
+			ObjectMeta: metav1.ObjectMeta{Namespace: ns, Name: fmt.Sprintf("svc%d", i)},
+		})
+		c.SetHTTPRoute(&gatewayapi.HTTPRoute{
+			TypeMeta:   metav1.TypeMeta{APIVersion: gatewayapi.GroupVersion.String(), Kind: "HTTPRoute"},
+			ObjectMeta: metav1.ObjectMeta{Namespace: ns, Name: fmt.Sprintf("hr%d", i)},
+			Spec: gatewayapi.HTTPRouteSpec{
+				CommonRouteSpec: gatewayapi.CommonRouteSpec{
+					ParentRefs: []gatewayapi.ParentReference{{Name: gatewayapi.ObjectName(fmt.Sprintf("gw%d", i%(n/10))), SectionName: &sn}},
+				},
+				Rules: []gatewayapi.HTTPRouteRule{{
+					BackendRefs: []gatewayapi.HTTPBackendRef{{
+						BackendRef: gatewayapi.BackendRef{
+							BackendObjectReference: gatewayapi.BackendObjectReference{Name: gatewayapi.ObjectName(fmt.Sprintf("svc%d", i))},
+						},
+					}},
+				}},
+			},
+		})
+	}
+	return c
+}
+
+func BenchmarkSIGCache_AttachedHTTPRoutes(b *testing.B) {
+	c := benchmarkCache(5000)
+	gw := c.GetGateway("ns0/gw0")
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		if len(c.AttachedHTTPRoutes(gw)) != 10 {
+			b.Fatal("expected 10 attached httproutes")
+		}
+	}
+}
+
+func BenchmarkSIGCache_AttachedGateways(b *testing.B) {
+	c := benchmarkCache(5000)
+	gwc := c.GetGatewayClass("gwc")
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		if len(c.AttachedGateways(gwc)) != 500 {
+			b.Fatal("expected 500 attached gateways")
+		}
+	}
+}
+
+func BenchmarkSIGCache_GetRootGateways(b *testing.B) {
+	c := benchmarkCache(5000)
+	svcs := []*v1.Service{c.GetService("ns0/svc0"), c.GetService("ns1/svc1")}
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		if len(c.GetRootGateways(svcs)) != 2 {
+			b.Fatal("expected 2 root gateways")
+		}
+	}
+}
+
+func BenchmarkSIGCache_GatewayRefsOfSecret(b *testing.B) {
+	c := benchmarkCache(5000)
+	scrt := c.GetSecret("ns0/scrt0")
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		if gws, err := c.GatewayRefsOfSecret(scrt); err != nil || len(gws) != 1 {
+			b.Fatalf("expected 1 gateway, got %v, %v", gws, err)
+		}
+	}
+}
+
+func BenchmarkSIGCache_ManagedTenants(b *testing.B) {
+	c := benchmarkCache(5000)
+	c.ControllerName = "f5.io/gateway-controller-name"
+	c.GetGatewayClass("gwc").Spec.ControllerName = "f5.io/gateway-controller-name"
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		if len(c.ManagedTenants()) != 11 {
+			b.Fatal("expected 11 tenants")
+		}
+	}
+}
@@ -0,0 +1,198 @@
+package pkg
+
+import (
+	"github.com/f5devcentral/f5-bigip-rest-go/utils"
+	gatewayapi "sigs.k8s.io/gateway-api/apis/v1"
+)
+
+// refIndex is a reverse index from the keyname of the referred resource to the keynames of the referring ones,
+// the referred keynames of each referring one are recorded for unset, so that it needn't the previous object.
+type refIndex struct {
+	referring map[string]map[string]bool
+	referred  map[string][]string
+}
+
+func newRefIndex() *refIndex {
+	return &refIndex{
+		referring: map[string]map[string]bool{},
+		referred:  map[string][]string{},
+	}
+}
+
+// set replaces the references of "from" with "tos".
+func (ri *refIndex) set(from string, tos ...string) {
+	ri.unset(from)
+	for _, to := range tos {
+		if _, f := ri.referring[to]; !f {
+			ri.referring[to] = map[string]bool{}
+		}
+		ri.referring[to][from] = true
+	}
+	if len(tos) > 0 {
+		ri.referred[from] = tos
+	}
+}
+
+func (ri *refIndex) unset(from string) {
+	for _, to := range ri.referred[from] {
+		delete(ri.referring[to], from)
+		if len(ri.referring[to]) == 0 {
+			delete(ri.referring, to)
+		}
+	}
+	delete(ri.referred, from)
+}
+
+// of returns the keynames referring to "to".
+func (ri *refIndex) of(to string) []string {
+	rlt := make([]string, 0, len(ri.referring[to]))
+	for k := range ri.referring[to] {
+		rlt = append(rlt, k)
+	}
+	return rlt
+}
+
+// sigIndexes are the reverse references of the cached gateways and httproutes, maintained on their Set/Unset,
+// so that the relationship lookups don't scan all the cached objects. They tell the candidates only,
+// whether the references are allowed, e.g. by listeners or ReferenceGrants, is still checked by the lookups.
+type sigIndexes struct {
+	// gatewayclass name -> gateways
+	classGateways *refIndex
+	// namespace -> gateways in it
+	namespaceGateways *refIndex
+	// secret -> gateways, by listeners' certificateRefs
+	secretGateways *refIndex
+	// gateway -> httproutes, by parentRefs
+	gatewayRoutes *refIndex
+	// service -> httproutes, by backendRefs and ExtensionRef filters
+	serviceRoutes *refIndex
+	// namespace -> httproutes in it
+	namespaceRoutes *refIndex
+}
+
+func newSIGIndexes() *sigIndexes {
+	return &sigIndexes{
+		classGateways:     newRefIndex(),
+		namespaceGateways: newRefIndex(),
+		secretGateways:    newRefIndex(),
+		gatewayRoutes:     newRefIndex(),
+		serviceRoutes:     newRefIndex(),
+		namespaceRoutes:   newRefIndex(),
+	}
+}
+
+// _indexes returns the indexes, created on the first write so that SIGCache literals work as well.
+// Must be called with the write lock held.
+func (c *SIGCache) _indexes() *sigIndexes {
+	if c.index == nil {
+		c.index = newSIGIndexes()
+	}
+	return c.index
+}
+
+// _lookup returns the keynames referring to "to" in the index chosen by which, safe under the read lock.
+func (c *SIGCache) _lookup(which func(*sigIndexes) *refIndex, to string) []string {
+	if c.index == nil {
+		return []string{}
+	}
+	return which(c.index).of(to)
+}
+
+func (c *SIGCache) _setGateway(gw *gatewayapi.Gateway) {
+	keyname := utils.Keyname(gw.Namespace, gw.Name)
+	c.Gateway[keyname] = gw
+
+	ix := c._indexes()
+	ix.classGateways.set(keyname, string(gw.Spec.GatewayClassName))
+	ix.namespaceGateways.set(keyname, gw.Namespace)
+	ix.secretGateways.set(keyname, gatewaySecretKeys(gw)...)
+}
+
+func (c *SIGCache) _unsetGateway(keyname string) {
+	delete(c.Gateway, keyname)
+
+	ix := c._indexes()
+	ix.classGateways.unset(keyname)
+	ix.namespaceGateways.unset(keyname)
+	ix.secretGateways.unset(keyname)
+}
+
+func (c *SIGCache) _setHTTPRoute(hr *gatewayapi.HTTPRoute) {
+	keyname := utils.Keyname(hr.Namespace, hr.Name)
+	c.HTTPRoute[keyname] = hr
+
+	ix := c._indexes()
+	ix.namespaceRoutes.set(keyname, hr.Namespace)
+	ix.gatewayRoutes.set(keyname, routeParentKeys(hr)...)
+	ix.serviceRoutes.set(keyname, routeServiceKeys(hr)...)
+}
+
+func (c *SIGCache) _unsetHTTPRoute(keyname string) {
+	delete(c.HTTPRoute, keyname)
+
+	ix := c._indexes()
+	ix.namespaceRoutes.unset(keyname)
+	ix.gatewayRoutes.unset(keyname)
+	ix.serviceRoutes.unset(keyname)
+}
+
+// gatewaySecretKeys returns the keynames of the secrets referred by the TLS-terminating listeners.
+func gatewaySecretKeys(gw *gatewayapi.Gateway) []string {
+	keys := []string{}
+	for _, listener := range gw.Spec.Listeners {
+		if listener.Protocol != gatewayapi.HTTPSProtocolType || listener.TLS == nil {
+			continue
+		}
+		if listener.TLS.Mode != nil && *listener.TLS.Mode != gatewayapi.TLSModeTerminate {
+			continue
+		}
+		for _, ref := range listener.TLS.CertificateRefs {
+			if validateSecretType(ref.Group, ref.Kind) != nil {
+				continue
+			}
+			ns := gw.Namespace
+			if ref.Namespace != nil {
+				ns = string(*ref.Namespace)
+			}
+			keys = append(keys, utils.Keyname(ns, string(ref.Name)))
+		}
+	}
+	return utils.Unified(keys)
+}
+
+// routeParentKeys returns the keynames of the gateways in the parentRefs.
+func routeParentKeys(hr *gatewayapi.HTTPRoute) []string {
+	keys := []string{}
+	for _, pr := range hr.Spec.ParentRefs {
+		ns := hr.Namespace
+		if pr.Namespace != nil {
+			ns = string(*pr.Namespace)
+		}
+		keys = append(keys, utils.Keyname(ns, string(pr.Name)))
+	}
+	return utils.Unified(keys)
+}
+
+// routeServiceKeys returns the keynames of the services in the backendRefs and ExtensionRef filters,
+// the same as what _attachedServices looks up.
+func routeServiceKeys(hr *gatewayapi.HTTPRoute) []string {
+	keys := []string{}
+	for _, rl := range hr.Spec.Rules {
+		for _, br := range rl.BackendRefs {
+			ns := hr.Namespace
+			if br.Namespace != nil {
+				ns = string(*br.Namespace)
+			}
+			keys = append(keys, utils.Keyname(ns, string(br.Name)))
+		}
+		for _, fl := range rl.Filters {
+			if fl.Type == gatewayapi.HTTPRouteFilterExtensionRef && fl.ExtensionRef != nil {
+				er := fl.ExtensionRef
+				if er.Group == "" && er.Kind == "Service" {
+					keys = append(keys, utils.Keyname(hr.Namespace, string(er.Name)))
+				}
+			}
+		}
+	}
+	return utils.Unified(keys)
+}
@@ -0,0 +1,85 @@
+package pkg
+
+import (
+	"reflect"
+	"sort"
+	"testing"
+
+	"github.com/f5devcentral/f5-bigip-rest-go/utils"
+	gatewayapi "sigs.k8s.io/gateway-api/apis/v1"
+)
+
+func Test_refIndex(t *testing.T) {
+	ri := newRefIndex()
+	ri.set("hr1", "gw1", "gw2")
+	ri.set("hr2", "gw1")
+
+	of := func(to string) []string {
+		rlt := ri.of(to)
+		sort.Strings(rlt)
+		return rlt
+	}
+	if !reflect.DeepEqual(of("gw1"), []string{"hr1", "hr2"}) || !reflect.DeepEqual(of("gw2"), []string{"hr1"}) {
+		t.Fatalf("unexpected index: %v", ri.referring)
+	}
+
+	ri.set("hr1", "gw3")
+	if !reflect.DeepEqual(of("gw1"), []string{"hr2"}) || len(of("gw2")) != 0 || !reflect.DeepEqual(of("gw3"), []string{"hr1"}) {
+		t.Fatalf("expected the references of hr1 replaced, got %v", ri.referring)
+	}
+
+	ri.unset("hr1")
+	ri.unset("hr2")
+	ri.unset("hr3")
+	if len(ri.referring) != 0 || len(ri.referred) != 0 {
+		t.Fatalf("expected empty index, got %v, %v", ri.referring, ri.referred)
+	}
+}
+
+func TestSIGCache_indexesFollowUpdates(t *testing.T) {
+	c := benchmarkCache(100)
+	keys := func(hrs []*gatewayapi.HTTPRoute) []string {
+		rlt := []string{}
+		for _, hr := range hrs {
+			rlt = append(rlt, hr.Namespace+"/"+hr.Name)
+		}
+		sort.Strings(rlt)
+		return rlt
+	}
+
+	gw0, gw1 := c.GetGateway("ns0/gw0"), c.GetGateway("ns1/gw1")
+	if !reflect.DeepEqual(keys(c.AttachedHTTPRoutes(gw0)), []string{"ns0/hr0", "ns0/hr10", "ns0/hr20", "ns0/hr30", "ns0/hr40",
+		"ns0/hr50", "ns0/hr60", "ns0/hr70", "ns0/hr80", "ns0/hr90"}) {
+		t.Fatalf("unexpected httproutes of gw0: %v", keys(c.AttachedHTTPRoutes(gw0)))
+	}
+
+	// move hr0 from gw0 to gw1, even if modified in place.
+	hr0 := c.GetHTTPRoute("ns0/hr0")
+	hr0.Namespace = "ns1"
+	c.UnsetHTTPRoute("ns0/hr0")
+	hr0.Spec.ParentRefs[0].Name = "gw1"
+	c.SetHTTPRoute(hr0)
+	if utils.Contains(keys(c.AttachedHTTPRoutes(gw0)), "ns0/hr0") || !utils.Contains(keys(c.AttachedHTTPRoutes(gw1)), "ns1/hr0") {
+		t.Fatalf("expected hr0 moved to gw1")
+	}
+	if hrs := c.HTTPRoutesRefsOf(c.GetService("ns0/svc0")); len(hrs) != 0 {
+		t.Fatalf("expected no route refers to ns0/svc0 across namespaces, got %v", keys(hrs))
+	}
+
+	gw0.Spec.Listeners[0].TLS.CertificateRefs[0].Name = "scrt1"
+	c.SetGateway(gw0)
+	if gws, err := c.GatewayRefsOfSecret(c.GetSecret("ns0/scrt0")); err != nil || len(gws) != 0 {
+		t.Fatalf("expected no gateway refers to scrt0, got %v, %v", gws, err)
+	}
+
+	c.UnsetGateway("ns0/gw0")
+	if gws := c.AttachedGateways(c.GetGatewayClass("gwc")); len(gws) != 9 {
+		t.Fatalf("expected 9 gateways left, got %d", len(gws))
+	}
+	if gwcs := c.NSImpactedGatewayClasses(c.GetNamespace("ns0")); len(gwcs) != 0 {
+		t.Fatalf("expected no gateway class impacted by ns0, got %v", gwcs)
+	}
+	if gwcs := c.NSImpactedGatewayClasses(c.GetNamespace("ns1")); !reflect.DeepEqual(gwcs, []string{"gwc"}) {
+		t.Fatalf("expected gwc impacted by ns1, got %v", gwcs)
+	}
+}
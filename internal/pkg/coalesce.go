@@ -0,0 +1,170 @@
+package pkg
+
+import (
+	"context"
+	"sync"
+	"time"
+
+	"github.com/f5devcentral/f5-bigip-rest-go/utils"
+)
+
+// backendCoalescer batches the Endpoints and Service events of each tenant, the pools of the
+// namespace are deployed once the events stop for interval, or at most maxLatency after the first one.
+type backendCoalescer struct {
+	interval   time.Duration
+	maxLatency time.Duration
+	pending    map[string]*pendingBackends
+	mutex      sync.Mutex
+	wakeup     chan struct{}
+	deploy     func(ctx context.Context, namespace string) error
+}
+
+type pendingBackends struct {
+	namespace string
+	first     time.Time
+	last      time.Time
+	events    int
+	// failures is the count of the consecutive failed deployments, which are retried no earlier than retryAt.
+	failures int
+	retryAt  time.Time
+}
+
+// SetupBackendCoalescer turns on coalescing the events of HandleBackends, which are handled
+// immediately if interval is not positive. maxLatency is at least interval.
+func SetupBackendCoalescer(interval, maxLatency time.Duration) {
+	if interval <= 0 {
+		coalescer = nil
+		return
+	}
+	if maxLatency < interval {
+		maxLatency = interval
+	}
+	coalescer = newBackendCoalescer(interval, maxLatency, deployBackends)
+}
+
+// BackendCoalescer deploys the coalesced backend events when they are due, until stopCh is closed.
+func BackendCoalescer(stopCh chan struct{}) {
+	bc := coalescer
+	if bc == nil {
+		return
+	}
+	for {
+		timer := time.NewTimer(bc.nextDue(time.Now()))
+		select {
+		case <-stopCh:
+			timer.Stop()
+			return
+		case <-bc.wakeup:
+			timer.Stop()
+		case <-timer.C:
+		}
+		bc.flush(time.Now())
+	}
+}
+
+func newBackendCoalescer(interval, maxLatency time.Duration, deploy func(context.Context, string) error) *backendCoalescer {
+	return &backendCoalescer{
+		interval:   interval,
+		maxLatency: maxLatency,
+		pending:    map[string]*pendingBackends{},
+		mutex:      sync.Mutex{},
+		wakeup:     make(chan struct{}, 1),
+		deploy:     deploy,
+	}
+}
+
+func (bc *backendCoalescer) add(namespace string, now time.Time) {
+	bc.mutex.Lock()
+	key := tenantName(namespace)
+	if p, f := bc.pending[key]; f {
+		p.last = now
+		p.events++
+	} else {
+		bc.pending[key] = &pendingBackends{namespace: namespace, first: now, last: now, events: 1}
+	}
+	bc.mutex.Unlock()
+
+	select {
+	case bc.wakeup <- struct{}{}:
+	default:
+	}
+}
+
+// nextDue returns how long to wait until the next batch is due.
+func (bc *backendCoalescer) nextDue(now time.Time) time.Duration {
+	bc.mutex.Lock()
+	defer bc.mutex.Unlock()
+
+	next := time.Hour
+	for _, p := range bc.pending {
+		if d := p.dueBy(bc.interval, bc.maxLatency).Sub(now); d < next {
+			next = d
+		}
+	}
+	if next < 0 {
+		return 0
+	}
+	return next
+}
+
+func (p *pendingBackends) dueBy(interval, maxLatency time.Duration) time.Time {
+	if p.events == 0 {
+		return p.retryAt
+	}
+	quiet, bound := p.last.Add(interval), p.first.Add(maxLatency)
+	if bound.Before(quiet) {
+		return bound
+	}
+	return quiet
+}
+
+// retry batches the failed namespace again, due after the backoff of the failures if no new event comes.
+func (bc *backendCoalescer) retry(p *pendingBackends, now time.Time) {
+	bc.mutex.Lock()
+	key := tenantName(p.namespace)
+	if np, f := bc.pending[key]; f {
+		np.failures = p.failures + 1
+	} else {
+		bc.pending[key] = &pendingBackends{
+			namespace: p.namespace,
+			first:     now,
+			last:      now,
+			failures:  p.failures + 1,
+			retryAt:   now.Add(backoff(p.failures)),
+		}
+	}
+	bc.mutex.Unlock()
+
+	select {
+	case bc.wakeup <- struct{}{}:
+	default:
+	}
+}
+
+// flush deploys the batches due at now, the failed ones are batched again with backoff.
+func (bc *backendCoalescer) flush(now time.Time) {
+	bc.mutex.Lock()
+	batches := []*pendingBackends{}
+	for k, p := range bc.pending {
+		if !p.dueBy(bc.interval, bc.maxLatency).After(now) {
+			batches = append(batches, p)
+			delete(bc.pending, k)
+		}
+	}
+	bc.mutex.Unlock()
+
+	for _, p := range batches {
+		ctx := NewContext()
+		slog := utils.LogFromContext(ctx)
+		slog.Debugf("deploying backends of namespace %s for %d events", p.namespace, p.events)
+		BackendBatches.Inc()
+		if p.events > 1 {
+			BackendSavedDeploys.Add(float64(p.events - 1))
+		}
+		if err := bc.deploy(ctx, p.namespace); err != nil {
+			slog.Errorf("failed to deploy backends of namespace %s, retrying after %d failures: %s",
+				p.namespace, p.failures+1, err.Error())
+			bc.retry(p, now)
+		}
+	}
+}
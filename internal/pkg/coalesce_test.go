@@ -0,0 +1,90 @@
+package pkg
+
+import (
+	"context"
+	"fmt"
+	"reflect"
+	"sort"
+	"testing"
+	"time"
+)
+
+func Test_backendCoalescer(t *testing.T) {
+	deployed := []string{}
+	bc := newBackendCoalescer(time.Second, 5*time.Second, func(ctx context.Context, namespace string) error {
+		deployed = append(deployed, namespace)
+		return nil
+	})
+	start := time.Now()
+	at := func(ms int) time.Time { return start.Add(time.Duration(ms) * time.Millisecond) }
+
+	if d := bc.nextDue(start); d != time.Hour {
+		t.Fatalf("expected nothing due, got %s", d)
+	}
+
+	// a rolling update keeps changing ns1 every 500ms, ns2 changes once.
+	for i := 0; i <= 8000; i += 500 {
+		bc.add("ns1", at(i))
+		if i == 1000 {
+			bc.add("ns2", at(i))
+		}
+		bc.flush(at(i))
+		if i == 1500 && len(deployed) != 0 {
+			t.Fatalf("expected nothing deployed within the interval, got %v", deployed)
+		}
+		if i == 2000 && !reflect.DeepEqual(deployed, []string{"ns2"}) {
+			t.Fatalf("expected ns2 deployed after being quiet for the interval, got %v", deployed)
+		}
+		if i == 5000 && !reflect.DeepEqual(deployed, []string{"ns2", "ns1"}) {
+			t.Fatalf("expected ns1 deployed at the max latency, got %v", deployed)
+		}
+	}
+	if d := bc.nextDue(at(8000)); d != time.Second {
+		t.Fatalf("expected ns1 due in the interval, got %s", d)
+	}
+	bc.flush(at(9000))
+	sort.Strings(deployed)
+	if !reflect.DeepEqual(deployed, []string{"ns1", "ns1", "ns2"}) {
+		t.Fatalf("expected ns1 deployed twice and ns2 once, got %v", deployed)
+	}
+	if len(bc.pending) != 0 {
+		t.Fatalf("expected nothing pending, got %v", bc.pending)
+	}
+}
+
+func Test_backendCoalescer_retry(t *testing.T) {
+	failures := 2
+	deployed := []string{}
+	bc := newBackendCoalescer(time.Second, 5*time.Second, func(ctx context.Context, namespace string) error {
+		if failures > 0 {
+			failures--
+			return fmt.Errorf("failed to parse services")
+		}
+		deployed = append(deployed, namespace)
+		return nil
+	})
+	start := time.Now()
+
+	bc.add("ns1", start)
+	bc.flush(start.Add(time.Second))
+	p, f := bc.pending[tenantName("ns1")]
+	if !f || p.failures != 1 {
+		t.Fatalf("expected the failed namespace batched again, got %v", bc.pending)
+	}
+	if d := bc.nextDue(start.Add(time.Second)); d < retryBaseDelay/2 || d > retryBaseDelay {
+		t.Fatalf("expected the retry due after backoff, got %s", d)
+	}
+
+	now := start.Add(time.Second + retryBaseDelay)
+	bc.flush(now)
+	if p := bc.pending[tenantName("ns1")]; p == nil || p.failures != 2 || p.retryAt.Sub(now) < retryBaseDelay {
+		t.Fatalf("expected the retry backed off further, got %v", p)
+	}
+
+	// a new event makes it due in the interval as usual.
+	bc.add("ns1", now)
+	bc.flush(now.Add(time.Second))
+	if !reflect.DeepEqual(deployed, []string{"ns1"}) || len(bc.pending) != 0 {
+		t.Fatalf("expected ns1 deployed at last, got %v, pending %v", deployed, bc.pending)
+	}
+}
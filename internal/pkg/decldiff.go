@@ -0,0 +1,302 @@
+package pkg
+
+import (
+	"fmt"
+	"reflect"
+	"sort"
+	"strings"
+
+	"github.com/f5devcentral/f5-bigip-rest-go/utils"
+)
+
+const (
+	DiffAction_Create = "create"
+	DiffAction_Delete = "delete"
+	DiffAction_Modify = "modify"
+)
+
+// ObjectDiff is the change of one AS3 object, e.g. a virtual, pool, iRule or certificate,
+// from the current declaration to the desired one.
+type ObjectDiff struct {
+	Tenant      string        `json:"tenant"`
+	Application string        `json:"application"`
+	Name        string        `json:"name"`
+	Class       string        `json:"class"`
+	Action      string        `json:"action"`
+	Changes     []FieldChange `json:"changes,omitempty"`
+}
+
+// FieldChange is the change of a property of the object, Path is in format of a.b[0].c.
+type FieldChange struct {
+	Path string      `json:"path"`
+	From interface{} `json:"from,omitempty"`
+	To   interface{} `json:"to,omitempty"`
+}
+
+// DiffDeclarations compares the tenants of the desired declaration with the current ones,
+// tenants not in desired are not compared. Both may be the AS3 body or the declaration only.
+func DiffDeclarations(current, desired map[string]interface{}) []ObjectDiff {
+	current, desired = declarationOf(current), declarationOf(desired)
+
+	diffs := []ObjectDiff{}
+	for _, tn := range sortedKeys(desired) {
+		if !isTenant(desired[tn]) {
+			continue
+		}
+		cobjs, dobjs := objectsOf(current[tn]), objectsOf(desired[tn])
+		keys := []string{}
+		for k := range cobjs {
+			keys = append(keys, k)
+		}
+		for k := range dobjs {
+			if _, f := cobjs[k]; !f {
+				keys = append(keys, k)
+			}
+		}
+		sort.Strings(keys)
+
+		for _, k := range keys {
+			app, name := splitObjectKey(k)
+			d := ObjectDiff{Tenant: tn, Application: app, Name: name}
+			cobj, cf := cobjs[k]
+			dobj, df := dobjs[k]
+			switch {
+			case !cf:
+				d.Action, d.Class = DiffAction_Create, classOf(dobj)
+			case !df:
+				d.Action, d.Class = DiffAction_Delete, classOf(cobj)
+			default:
+				d.Changes = diffFields("", normalized(cobj), normalized(dobj))
+				if len(d.Changes) == 0 {
+					continue
+				}
+				d.Action, d.Class = DiffAction_Modify, classOf(dobj)
+			}
+			diffs = append(diffs, d)
+		}
+	}
+	return diffs
+}
+
+// FormatDiffs renders the diffs in a human-readable way, with multi-line strings, e.g. iRules,
+// compared line by line.
+func FormatDiffs(diffs []ObjectDiff) string {
+	if len(diffs) == 0 {
+		return "no changes\n"
+	}
+	marks := map[string]string{DiffAction_Create: "+", DiffAction_Delete: "-", DiffAction_Modify: "~"}
+	var b strings.Builder
+	for _, d := range diffs {
+		fmt.Fprintf(&b, "%s %s (%s)\n", marks[d.Action], utils.Keyname(d.Tenant, d.Application, d.Name), d.Class)
+		for _, c := range d.Changes {
+			from, fok := c.From.(string)
+			to, tok := c.To.(string)
+			if fok && tok && (strings.Contains(from, "\n") || strings.Contains(to, "\n")) {
+				fmt.Fprintf(&b, "    %s:\n", c.Path)
+				for _, l := range withContext(diffLines(strings.Split(from, "\n"), strings.Split(to, "\n")), 3) {
+					fmt.Fprintf(&b, "      %s\n", l)
+				}
+				continue
+			}
+			fmt.Fprintf(&b, "    %s: %s -> %s\n", c.Path, formatValue(c.From), formatValue(c.To))
+		}
+	}
+	return RedactText(b.String())
+}
+
+func declarationOf(body map[string]interface{}) map[string]interface{} {
+	if decl, ok := body["declaration"].(map[string]interface{}); ok {
+		return decl
+	}
+	if body == nil {
+		return map[string]interface{}{}
+	}
+	return body
+}
+
+// objectsOf returns the objects of the tenant, keyed by <application>/<name>.
+func objectsOf(t interface{}) map[string]interface{} {
+	rlt := map[string]interface{}{}
+	tm, ok := t.(map[string]interface{})
+	if !ok {
+		return rlt
+	}
+	for an, app := range tm {
+		if !isApplication(app) {
+			continue
+		}
+		for on, obj := range app.(map[string]interface{}) {
+			if o, ok := obj.(map[string]interface{}); ok && o["class"] != nil {
+				rlt[utils.Keyname(an, on)] = obj
+			}
+		}
+	}
+	return rlt
+}
+
+func splitObjectKey(k string) (string, string) {
+	app, name, _ := strings.Cut(k, "/")
+	return app, name
+}
+
+func classOf(obj interface{}) string {
+	if o, ok := obj.(map[string]interface{}); ok {
+		return fmt.Sprintf("%v", o["class"])
+	}
+	return ""
+}
+
+// diffFields returns the changed leaves between the normalized a and b,
+// lists of different lengths are compared as a whole.
+//
+// A sensitive field is compared only if it's plain text on both sides, AS3 returns e.g. the privateKey
+// of a Certificate encrypted as {ciphertext, protected}, which never equals to the PEM desired.
+func diffFields(path string, a, b interface{}) []FieldChange {
+	if reflect.DeepEqual(a, b) {
+		return nil
+	}
+	if isSensitive(path) {
+		_, aok := a.(string)
+		_, bok := b.(string)
+		if a != nil && b != nil && (!aok || !bok) {
+			return nil
+		}
+		return []FieldChange{{Path: path, From: redacted(a), To: redacted(b)}}
+	}
+	join := func(k string) string {
+		if path == "" {
+			return k
+		}
+		return path + "." + k
+	}
+
+	switch av := a.(type) {
+	case map[string]interface{}:
+		bv, ok := b.(map[string]interface{})
+		if !ok {
+			break
+		}
+		changes := []FieldChange{}
+		keys := sortedKeys(av)
+		for k := range bv {
+			if _, f := av[k]; !f {
+				keys = append(keys, k)
+			}
+		}
+		sort.Strings(keys)
+		for _, k := range keys {
+			changes = append(changes, diffFields(join(k), av[k], bv[k])...)
+		}
+		return changes
+	case []interface{}:
+		bv, ok := b.([]interface{})
+		if !ok || len(av) != len(bv) {
+			break
+		}
+		changes := []FieldChange{}
+		for i := range av {
+			changes = append(changes, diffFields(fmt.Sprintf("%s[%d]", path, i), av[i], bv[i])...)
+		}
+		return changes
+	}
+	return []FieldChange{{Path: path, From: redactDeclaration(a), To: redactDeclaration(b)}}
+}
+
+// normalized converts the value to the generic JSON types, so that e.g. []string and
+// []interface{} from the parser and from the BIG-IP are comparable.
+func normalized(v interface{}) interface{} {
+	if v == nil {
+		return nil
+	}
+	n, err := utils.DeepCopy(v)
+	if err != nil {
+		return v
+	}
+	return n
+}
+
+func formatValue(v interface{}) string {
+	if v == nil {
+		return "<none>"
+	}
+	b, err := utils.MarshalNoEscaping(v)
+	if err != nil {
+		return fmt.Sprintf("%v", v)
+	}
+	return strings.TrimSpace(string(b))
+}
+
+// diffLines returns the lines of a and b prefixed with "-", "+" or " ", by longest common subsequence.
+func diffLines(a, b []string) []string {
+	lcs := make([][]int, len(a)+1)
+	for i := range lcs {
+		lcs[i] = make([]int, len(b)+1)
+	}
+	for i := len(a) - 1; i >= 0; i-- {
+		for j := len(b) - 1; j >= 0; j-- {
+			if a[i] == b[j] {
+				lcs[i][j] = lcs[i+1][j+1] + 1
+			} else if lcs[i+1][j] >= lcs[i][j+1] {
+				lcs[i][j] = lcs[i+1][j]
+			} else {
+				lcs[i][j] = lcs[i][j+1]
+			}
+		}
+	}
+
+	rlt := []string{}
+	i, j := 0, 0
+	for i < len(a) && j < len(b) {
+		switch {
+		case a[i] == b[j]:
+			rlt = append(rlt, "  "+a[i])
+			i, j = i+1, j+1
+		case lcs[i+1][j] >= lcs[i][j+1]:
+			rlt = append(rlt, "- "+a[i])
+			i++
+		default:
+			rlt = append(rlt, "+ "+b[j])
+			j++
+		}
+	}
+	for ; i < len(a); i++ {
+		rlt = append(rlt, "- "+a[i])
+	}
+	for ; j < len(b); j++ {
+		rlt = append(rlt, "+ "+b[j])
+	}
+	return rlt
+}
+
+// withContext keeps the changed lines of diffLines and n lines around them, the others are folded to "...".
+func withContext(lines []string, n int) []string {
+	keep := make([]bool, len(lines))
+	for i, l := range lines {
+		if strings.HasPrefix(l, "  ") {
+			continue
+		}
+		for j := i - n; j <= i+n; j++ {
+			if j >= 0 && j < len(lines) {
+				keep[j] = true
+			}
+		}
+	}
+	rlt := []string{}
+	for i, l := range lines {
+		if keep[i] {
+			rlt = append(rlt, l)
+		} else if i == 0 || keep[i-1] {
+			rlt = append(rlt, "  ...")
+		}
+	}
+	return rlt
+}
+
+func sortedKeys(m map[string]interface{}) []string {
+	keys := []string{}
+	for k := range m {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	return keys
+}
@@ -0,0 +1,286 @@
+package pkg
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+	"time"
+
+	f5_bigip "github.com/f5devcentral/f5-bigip-rest-go/bigip"
+	"github.com/f5devcentral/f5-bigip-rest-go/utils"
+)
+
+// driftKinds maps the AS3 classes generated by the controller to the BIG-IP resource kinds.
+var driftKinds = map[string]string{
+	"Service_HTTP":  "ltm/virtual",
+	"Service_HTTPS": "ltm/virtual",
+	"Pool":          "ltm/pool",
+	"iRule":         "ltm/rule",
+	"TLS_Server":    "ltm/profile/client-ssl",
+}
+
+// DriftDetector compares the deployed tenants with the actual resources on each BIG-IP periodically,
+// reports the drifts via metrics and logs, and re-applies the drifted tenants if selfHeal is true.
+func DriftDetector(stopCh chan struct{}, interval time.Duration, selfHeal bool) {
+	if interval <= 0 {
+		return
+	}
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-stopCh:
+			return
+		case <-ticker.C:
+			for _, w := range workers() {
+				checkDrifts(w, selfHeal)
+			}
+		}
+	}
+}
+
+func checkDrifts(w *bigipWorker, selfHeal bool) {
+	defer utils.TimeItToPrometheus()()
+
+	ctx := NewContext()
+	slog := utils.LogFromContext(ctx)
+
+	drifted := []string{}
+	bc := &f5_bigip.BIGIPContext{Context: ctx, BIGIP: *w.bigip}
+	for name, t := range w.appliedTenants() {
+		drifts, err := detectDrifts(bc, name, t.(map[string]interface{}))
+		if err != nil {
+			slog.Warnf("failed to check drifts of tenant %s on %s: %s", name, w.bigip.URL, err.Error())
+			continue
+		}
+		DriftedResources.WithLabelValues(w.bigip.URL, name).Set(float64(len(drifts)))
+		if len(drifts) > 0 {
+			slog.Warnf("tenant %s drifted on %s: %s", name, w.bigip.URL, strings.Join(drifts, "; "))
+			drifted = append(drifted, name)
+		}
+	}
+
+	if selfHeal && len(drifted) > 0 {
+		slog.Infof("re-applying drifted tenants to %s: %s", w.bigip.URL, drifted)
+		w.requestSelfHeal(ctx, drifted)
+	}
+}
+
+// detectDrifts returns the differences between the AS3 tenant declaration and the resources on BIG-IP,
+// i.e. the missing and unexpected resources, the pool members, the destinations, pools and iRules of
+// the virtuals and the text of the iRules.
+func detectDrifts(bc *f5_bigip.BIGIPContext, partition string, tenant map[string]interface{}) ([]string, error) {
+	desired, optional := desiredResources(partition, tenant)
+
+	kinds := []string{}
+	for kind := range desired {
+		kinds = append(kinds, kind)
+	}
+	sort.Strings(kinds)
+	existings, err := bc.GetExistingResources(partition, kinds)
+	if err != nil {
+		return nil, err
+	}
+
+	members := map[string][]interface{}{}
+	for key := range desired["ltm/pool"] {
+		if _, f := (*existings)["ltm/pool"][key]; !f {
+			continue
+		}
+		p, f, n := splitKeyname(key)
+		if members[key], err = bc.Members(n, p, f); err != nil {
+			return nil, err
+		}
+	}
+
+	return diffResources(desired, optional, *existings, members), nil
+}
+
+// desiredResources returns the BIG-IP resources expected from the AS3 tenant declaration,
+// in format of kind: partition/folder/name: declaration, and the ones AS3 may create additionally.
+func desiredResources(partition string, tenant map[string]interface{}) (map[string]map[string]interface{}, map[string]bool) {
+	desired := map[string]map[string]interface{}{}
+	optional := map[string]bool{}
+	for _, kind := range driftKinds {
+		desired[kind] = map[string]interface{}{}
+	}
+	for folder, app := range tenant {
+		if _, ok := app.(map[string]interface{}); !ok {
+			continue
+		}
+		for name, res := range app.(map[string]interface{}) {
+			r, ok := res.(map[string]interface{})
+			if !ok {
+				continue
+			}
+			kind, f := driftKinds[fmt.Sprintf("%v", r["class"])]
+			if !f {
+				continue
+			}
+			desired[kind][utils.Keyname(partition, folder, name)] = r
+			if r["class"] == "Service_HTTPS" {
+				// AS3 creates the http-to-https redirect virtual by default.
+				optional[utils.Keyname(partition, folder, name+"-Redirect-")] = true
+			}
+		}
+	}
+	return desired, optional
+}
+
+func diffResources(desired map[string]map[string]interface{}, optional map[string]bool,
+	existings map[string]map[string]interface{}, members map[string][]interface{}) []string {
+	drifts := []string{}
+	for kind, resources := range desired {
+		actual := existings[kind]
+		for key, r := range resources {
+			if _, f := actual[key]; !f {
+				drifts = append(drifts, fmt.Sprintf("missing %s %s", kind, key))
+				continue
+			}
+			switch kind {
+			case "ltm/pool":
+				drifts = append(drifts, poolMemberDrifts(key, r.(map[string]interface{}), members[key])...)
+			case "ltm/virtual":
+				drifts = append(drifts, virtualDrifts(key, r.(map[string]interface{}), actual[key])...)
+			case "ltm/rule":
+				drifts = append(drifts, ruleDrifts(key, r.(map[string]interface{}), actual[key])...)
+			}
+		}
+		for key := range actual {
+			if _, f := resources[key]; !f && !optional[key] {
+				drifts = append(drifts, fmt.Sprintf("unexpected %s %s", kind, key))
+			}
+		}
+	}
+	sort.Strings(drifts)
+	return drifts
+}
+
+func poolMemberDrifts(poolKey string, pool map[string]interface{}, items []interface{}) []string {
+	actual := []string{}
+	for _, item := range items {
+		mb := item.(map[string]interface{})
+		name, addr := fmt.Sprintf("%v", mb["name"]), fmt.Sprintf("%v", mb["address"])
+		addr = strings.Split(addr, "%")[0]
+		port := name[strings.LastIndexAny(name, ":.")+1:]
+		actual = append(actual, memberKey(addr, port))
+	}
+	desired := []string{}
+	if mbs, ok := pool["members"].([]interface{}); ok {
+		for _, mb := range mbs {
+			m := mb.(map[string]interface{})
+			port := fmt.Sprintf("%v", m["servicePort"])
+			for _, addr := range stringsOf(m["serverAddresses"]) {
+				desired = append(desired, memberKey(addr, port))
+			}
+		}
+	}
+
+	drifts := []string{}
+	c, d, _ := utils.Diff(actual, desired)
+	for _, m := range c {
+		drifts = append(drifts, fmt.Sprintf("missing member %s of pool %s", m, poolKey))
+	}
+	for _, m := range d {
+		drifts = append(drifts, fmt.Sprintf("unexpected member %s of pool %s", m, poolKey))
+	}
+	return drifts
+}
+
+// virtualDrifts compares the destination, the pool and the iRules of the virtual with the declared ones.
+func virtualDrifts(key string, virtual map[string]interface{}, props interface{}) []string {
+	drifts := []string{}
+	actual, _ := props.(map[string]interface{})
+	partition, folder, _ := splitKeyname(key)
+
+	addrs := stringsOf(virtual["virtualAddresses"])
+	if len(addrs) > 0 {
+		desired := memberKey(addrs[0], fmt.Sprintf("%v", virtual["virtualPort"]))
+		dest := fmt.Sprintf("%v", actual["destination"])
+		dest = dest[strings.LastIndex(dest, "/")+1:]
+		sep := strings.LastIndexAny(dest, ":.")
+		if sep < 0 || memberKey(strings.Split(dest[:sep], "%")[0], dest[sep+1:]) != desired {
+			drifts = append(drifts, fmt.Sprintf("modified destination of virtual %s: %s, expected %s", key, dest, desired))
+		}
+	}
+
+	pool, _ := actual["pool"].(string)
+	if p, ok := virtual["pool"].(string); ok {
+		if expected := as3Path(partition, folder, p); pool != expected {
+			drifts = append(drifts, fmt.Sprintf("modified pool of virtual %s: '%s', expected %s", key, pool, expected))
+		}
+	} else if pool != "" {
+		drifts = append(drifts, fmt.Sprintf("unexpected pool %s of virtual %s", pool, key))
+	}
+
+	desired := []string{}
+	for _, r := range stringsOf(virtual["iRules"]) {
+		desired = append(desired, as3Path(partition, folder, r))
+	}
+	rules := stringsOf(actual["rules"])
+	c, d, _ := utils.Diff(rules, desired)
+	for _, r := range c {
+		drifts = append(drifts, fmt.Sprintf("missing irule %s of virtual %s", r, key))
+	}
+	for _, r := range d {
+		drifts = append(drifts, fmt.Sprintf("unexpected irule %s of virtual %s", r, key))
+	}
+	return drifts
+}
+
+// ruleDrifts compares the text of the iRule with the declared one, ignoring the leading and trailing spaces.
+func ruleDrifts(key string, rule map[string]interface{}, props interface{}) []string {
+	desired, ok := rule["iRule"].(string)
+	if !ok {
+		// the iRule is referred by url or base64 encoded, not compared.
+		return []string{}
+	}
+	actual, _ := props.(map[string]interface{})
+	text, _ := actual["apiAnonymous"].(string)
+	if strings.TrimSpace(text) != strings.TrimSpace(desired) {
+		return []string{fmt.Sprintf("modified irule %s", key)}
+	}
+	return []string{}
+}
+
+// as3Path returns the full path of the AS3 reference, which is relative to the application if not starting with '/'.
+func as3Path(partition, folder, name string) string {
+	if strings.HasPrefix(name, "/") {
+		return name
+	}
+	return "/" + strings.Join([]string{partition, folder, name}, "/")
+}
+
+func stringsOf(v interface{}) []string {
+	switch a := v.(type) {
+	case []string:
+		return a
+	case []interface{}:
+		rlt := []string{}
+		for _, i := range a {
+			rlt = append(rlt, fmt.Sprintf("%v", i))
+		}
+		return rlt
+	default:
+		return []string{}
+	}
+}
+
+func memberKey(addr, port string) string {
+	if utils.IsIpv6(addr) {
+		return fmt.Sprintf("[%s]:%s", addr, port)
+	}
+	return fmt.Sprintf("%s:%s", addr, port)
+}
+
+func splitKeyname(key string) (string, string, string) {
+	a := strings.Split(key, "/")
+	switch len(a) {
+	case 2:
+		return a[0], "", a[1]
+	case 3:
+		return a[0], a[1], a[2]
+	default:
+		return "", "", key
+	}
+}
@@ -0,0 +1,129 @@
+package pkg
+
+import (
+	"reflect"
+	"testing"
+)
+
+func Test_diffResources(t *testing.T) {
+	tenant := map[string]interface{}{
+		"class": "Tenant",
+		"serviceMain": map[string]interface{}{
+			"class": "Application",
+			"gw.default.mygateway.https.0": map[string]interface{}{
+				"class": "Service_HTTPS",
+			},
+			"gw.default.mygateway.https": map[string]interface{}{
+				"class": "iRule",
+			},
+			"web": map[string]interface{}{
+				"class": "Pool",
+				"members": []interface{}{
+					map[string]interface{}{"servicePort": 80, "serverAddresses": []string{"10.42.0.1"}},
+					map[string]interface{}{"servicePort": 80, "serverAddresses": []string{"fd00::1"}},
+				},
+			},
+		},
+	}
+	desired, optional := desiredResources("default", tenant)
+
+	existings := map[string]map[string]interface{}{
+		"ltm/virtual": {
+			"default/serviceMain/gw.default.mygateway.https.0":           map[string]interface{}{},
+			"default/serviceMain/gw.default.mygateway.https.0-Redirect-": map[string]interface{}{},
+			"default/serviceMain/manual":                                 map[string]interface{}{},
+		},
+		"ltm/pool": {
+			"default/serviceMain/web": map[string]interface{}{},
+		},
+		"ltm/rule": {},
+	}
+	members := map[string][]interface{}{
+		"default/serviceMain/web": {
+			map[string]interface{}{"name": "10.42.0.1:80", "address": "10.42.0.1"},
+			map[string]interface{}{"name": "10.42.0.9:80", "address": "10.42.0.9%0"},
+		},
+	}
+
+	drifts := diffResources(desired, optional, existings, members)
+	expected := []string{
+		"missing ltm/rule default/serviceMain/gw.default.mygateway.https",
+		"missing member [fd00::1]:80 of pool default/serviceMain/web",
+		"unexpected ltm/virtual default/serviceMain/manual",
+		"unexpected member 10.42.0.9:80 of pool default/serviceMain/web",
+	}
+	if !reflect.DeepEqual(drifts, expected) {
+		t.Errorf("expected %v, got %v", expected, drifts)
+	}
+
+	existings["ltm/rule"]["default/serviceMain/gw.default.mygateway.https"] = map[string]interface{}{}
+	delete(existings["ltm/virtual"], "default/serviceMain/manual")
+	members["default/serviceMain/web"] = []interface{}{
+		map[string]interface{}{"name": "10.42.0.1:80", "address": "10.42.0.1"},
+		map[string]interface{}{"name": "fd00::1.80", "address": "fd00::1"},
+	}
+	if drifts := diffResources(desired, optional, existings, members); len(drifts) != 0 {
+		t.Errorf("expected no drift, got %v", drifts)
+	}
+}
+
+func Test_diffResources_properties(t *testing.T) {
+	tenant := map[string]interface{}{
+		"class": "Tenant",
+		"serviceMain": map[string]interface{}{
+			"class": "Application",
+			"gw.default.mygateway.http.0": map[string]interface{}{
+				"class":            "Service_HTTP",
+				"virtualAddresses": []string{"10.250.17.121"},
+				"virtualPort":      80,
+				"iRules":           []string{"hr.default.web"},
+			},
+			"gw.default.mygateway.http6.0": map[string]interface{}{
+				"class":            "Service_HTTP",
+				"virtualAddresses": []interface{}{"fd00::121"},
+				"virtualPort":      float64(80),
+			},
+			"hr.default.web": map[string]interface{}{
+				"class": "iRule",
+				"iRule": "\nwhen HTTP_REQUEST {}\n",
+			},
+		},
+	}
+	desired, optional := desiredResources("default", tenant)
+
+	existings := map[string]map[string]interface{}{
+		"ltm/virtual": {
+			"default/serviceMain/gw.default.mygateway.http.0": map[string]interface{}{
+				"destination": "/default/10.250.17.121:80",
+				"rules":       []interface{}{"/default/serviceMain/hr.default.web"},
+			},
+			"default/serviceMain/gw.default.mygateway.http6.0": map[string]interface{}{
+				"destination": "/default/fd00::121%0.80",
+			},
+		},
+		"ltm/rule": {
+			"default/serviceMain/hr.default.web": map[string]interface{}{"apiAnonymous": "when HTTP_REQUEST {}"},
+		},
+	}
+	if drifts := diffResources(desired, optional, existings, nil); len(drifts) != 0 {
+		t.Fatalf("expected no drift, got %v", drifts)
+	}
+
+	existings["ltm/virtual"]["default/serviceMain/gw.default.mygateway.http.0"] = map[string]interface{}{
+		"destination": "/default/10.250.17.121:8080",
+		"pool":        "/default/serviceMain/manual",
+		"rules":       []interface{}{"/Common/manual"},
+	}
+	existings["ltm/rule"]["default/serviceMain/hr.default.web"] = map[string]interface{}{"apiAnonymous": "when HTTP_REQUEST { drop }"}
+	drifts := diffResources(desired, optional, existings, nil)
+	expected := []string{
+		"missing irule /default/serviceMain/hr.default.web of virtual default/serviceMain/gw.default.mygateway.http.0",
+		"modified destination of virtual default/serviceMain/gw.default.mygateway.http.0: 10.250.17.121:8080, expected 10.250.17.121:80",
+		"modified irule default/serviceMain/hr.default.web",
+		"unexpected irule /Common/manual of virtual default/serviceMain/gw.default.mygateway.http.0",
+		"unexpected pool /default/serviceMain/manual of virtual default/serviceMain/gw.default.mygateway.http.0",
+	}
+	if !reflect.DeepEqual(drifts, expected) {
+		t.Errorf("expected %v, got %v", expected, drifts)
+	}
+}
@@ -0,0 +1,145 @@
+package pkg
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+
+	"github.com/f5devcentral/f5-bigip-rest-go/deployer"
+	"github.com/f5devcentral/f5-bigip-rest-go/utils"
+	v1 "k8s.io/api/core/v1"
+	k8serrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/types"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+)
+
+const (
+	DryRun_Log       = "log"
+	DryRun_Dir       = "dir"
+	DryRun_ConfigMap = "configmap"
+)
+
+// dryRunWriter renders the AS3 declarations of each BIG-IP to logs, files or a ConfigMap
+// instead of deploying them, one file or ConfigMap key per BIG-IP.
+type dryRunWriter struct {
+	mode      string
+	dir       string
+	reader    client.Reader
+	writer    client.Writer
+	namespace string
+	name      string
+	mutex     sync.Mutex
+}
+
+// SetupDryRun turns on the dry-run mode with target in format of:
+//
+//	log
+//	dir:<directory>
+//	configmap:<namespace>/<name>
+//
+// reader and writer are used only by the configmap target.
+func SetupDryRun(target string, reader client.Reader, writer client.Writer) error {
+	mode, arg, _ := strings.Cut(target, ":")
+	dr := &dryRunWriter{mode: mode, reader: reader, writer: writer, mutex: sync.Mutex{}}
+	switch mode {
+	case DryRun_Log:
+	case DryRun_Dir:
+		if arg == "" {
+			return fmt.Errorf("missing directory in dry-run target %s", target)
+		}
+		if err := os.MkdirAll(arg, 0755); err != nil {
+			return err
+		}
+		dr.dir = arg
+	case DryRun_ConfigMap:
+		nn := strings.Split(arg, "/")
+		if len(nn) != 2 || nn[0] == "" || nn[1] == "" {
+			return fmt.Errorf("invalid configmap <namespace>/<name> in dry-run target %s", target)
+		}
+		dr.namespace, dr.name = nn[0], nn[1]
+	default:
+		return fmt.Errorf("unsupported dry-run target %s, valid values: %s, %s:<directory>, %s:<namespace>/<name>",
+			target, DryRun_Log, DryRun_Dir, DryRun_ConfigMap)
+	}
+	dryRun = dr
+	return nil
+}
+
+// IsDryRun tells if the declarations are rendered only, without touching BIG-IPs.
+func IsDryRun() bool {
+	return dryRun != nil
+}
+
+// write renders the declaration for the BIG-IP url to the target.
+func (dr *dryRunWriter) write(ctx context.Context, url string, as3body map[string]interface{}) error {
+	dr.mutex.Lock()
+	defer dr.mutex.Unlock()
+
+	// the rendered declarations are kept in logs, files or a ConfigMap, never with private keys.
+	b, err := json.MarshalIndent(redactDeclaration(as3body), "", "  ")
+	if err != nil {
+		return err
+	}
+	switch dr.mode {
+	case DryRun_Dir:
+		return os.WriteFile(filepath.Join(dr.dir, storeKey(url)+".json"), b, 0644)
+	case DryRun_ConfigMap:
+		return dr.writeConfigMap(ctx, storeKey(url), string(b))
+	default:
+		utils.LogFromContext(ctx).Infof("dry-run AS3 declaration for %s: %s", url, string(b))
+		return nil
+	}
+}
+
+func (dr *dryRunWriter) writeConfigMap(ctx context.Context, key, value string) error {
+	var cm v1.ConfigMap
+	err := dr.reader.Get(ctx, types.NamespacedName{Namespace: dr.namespace, Name: dr.name}, &cm)
+	if k8serrors.IsNotFound(err) {
+		cm = v1.ConfigMap{
+			ObjectMeta: metav1.ObjectMeta{Namespace: dr.namespace, Name: dr.name},
+			Data:       map[string]string{key: value},
+		}
+		return dr.writer.Create(ctx, &cm)
+	} else if err != nil {
+		return err
+	}
+	if cm.Data == nil {
+		cm.Data = map[string]string{}
+	}
+	if cm.Data[key] == value {
+		return nil
+	}
+	cm.Data[key] = value
+	return dr.writer.Update(ctx, &cm)
+}
+
+// renderDesired writes the declaration of all the desired tenants of the worker instead of
+// deploying the changed ones, so that the rendered one always reflects the full state.
+func (w *bigipWorker) renderDesired(r deployer.DeployRequest, tenants map[string]interface{}) {
+	as3body := RestToAS3(map[string]interface{}{})
+	w.mutex.RLock()
+	for k, t := range w.desired {
+		as3body["declaration"].(map[string]interface{})[k] = t
+	}
+	w.mutex.RUnlock()
+
+	results := map[string]error{}
+	err := dryRun.write(r.Context, w.bigip.URL, as3body)
+	if err != nil {
+		err = fmt.Errorf("failed to render dry-run declaration for %s: %s", w.bigip.URL, err.Error())
+		for k := range tenants {
+			results[k] = err
+		}
+	}
+	r.To = &as3body
+	DoneDeploys.Add(deployer.DeployResponse{
+		DeployRequest: r,
+		Status:        err,
+	})
+	w.deployed(tenants, results, nil)
+}
@@ -0,0 +1,69 @@
+package pkg
+
+import (
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"testing"
+
+	f5_bigip "github.com/f5devcentral/f5-bigip-rest-go/bigip"
+	"github.com/f5devcentral/f5-bigip-rest-go/deployer"
+	"github.com/f5devcentral/f5-bigip-rest-go/utils"
+)
+
+func Test_SetupDryRun(t *testing.T) {
+	defer func() { dryRun = nil }()
+
+	for _, target := range []string{"", "file", "dir", "dir:", "configmap:default", "configmap:/name"} {
+		if err := SetupDryRun(target, nil, nil); err == nil {
+			t.Errorf("expected error for dry-run target '%s'", target)
+		}
+	}
+	for _, target := range []string{"log", "dir:" + t.TempDir(), "configmap:default/rendered"} {
+		if err := SetupDryRun(target, nil, nil); err != nil {
+			t.Errorf("unexpected error for dry-run target '%s': %s", target, err.Error())
+		}
+	}
+}
+
+func Test_bigipWorker_renderDesired(t *testing.T) {
+	defer func(dq *utils.DeployQueue) { dryRun, DoneDeploys = nil, dq }(DoneDeploys)
+	DoneDeploys = utils.NewDeployQueue()
+
+	dir := t.TempDir()
+	if err := SetupDryRun("dir:"+dir, nil, nil); err != nil {
+		t.Fatal(err)
+	}
+	request := func(tenant string) deployer.DeployRequest {
+		as3 := RestToAS3(map[string]interface{}{
+			tenant: map[string]interface{}{"serviceMain": map[string]interface{}{}},
+		})
+		return deployer.DeployRequest{To: &as3, AS3: true, Context: NewContext()}
+	}
+
+	url := "https://10.250.15.180:443"
+	w := newBIGIPWorker(&f5_bigip.BIGIP{URL: url})
+	w.queue.Add(request("a"))
+	w.handleNext()
+	w.queue.Add(request("b"))
+	w.handleNext()
+
+	b, err := os.ReadFile(filepath.Join(dir, storeKey(url)+".json"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	var rendered map[string]interface{}
+	if err := json.Unmarshal(b, &rendered); err != nil {
+		t.Fatal(err)
+	}
+	decl := rendered["declaration"].(map[string]interface{})
+	if !isTenant(decl["a"]) || !isTenant(decl["b"]) {
+		t.Errorf("expected full state of tenants a and b rendered, got %v", decl)
+	}
+	if DoneDeploys.Len() != 2 {
+		t.Errorf("expected 2 responses, got %d", DoneDeploys.Len())
+	}
+	if len(w.appliedHashes()) != 2 {
+		t.Errorf("expected rendered tenants recorded as applied, got %v", w.applied)
+	}
+}
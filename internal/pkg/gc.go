@@ -0,0 +1,97 @@
+package pkg
+
+import (
+	"sort"
+	"time"
+
+	"github.com/f5devcentral/f5-bigip-rest-go/deployer"
+	"github.com/f5devcentral/f5-bigip-rest-go/utils"
+)
+
+// TenantGC removes the tenants created by the controller but no longer expected, e.g. the ones of
+// the gateway classes deleted while the controller is down, at startup and then periodically.
+func TenantGC(stopCh chan struct{}, interval time.Duration) {
+	if interval <= 0 {
+		return
+	}
+	for !ActiveSIGs.SyncedAtStart {
+		select {
+		case <-stopCh:
+			return
+		case <-time.After(time.Second):
+		}
+	}
+
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		for _, w := range workers() {
+			collectOrphanTenants(w)
+		}
+		select {
+		case <-stopCh:
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+func collectOrphanTenants(w *bigipWorker) {
+	defer utils.TimeItToPrometheus()()
+
+	ctx := NewContext()
+	slog := utils.LogFromContext(ctx)
+
+	decl, err := w.as3.declaration()
+	if err != nil {
+		slog.Warnf("failed to get AS3 declaration from %s: %s", w.bigip.URL, err.Error())
+		return
+	}
+	orphans := orphanTenants(decl, ActiveSIGs.ManagedTenants())
+	if len(orphans) == 0 {
+		return
+	}
+
+	slog.Infof("removing orphan tenants from %s: %s", w.bigip.URL, orphans)
+	cfgs := map[string]interface{}{}
+	for _, tn := range orphans {
+		cfgs[tn] = map[string]interface{}{}
+	}
+	as3 := RestToAS3(cfgs)
+	w.queue.Add(deployer.DeployRequest{
+		To:      &as3,
+		AS3:     true,
+		Context: ctx,
+	})
+}
+
+// orphanTenants returns the non-empty tenants owned by this controller instance in the declaration, but not expected.
+func orphanTenants(decl map[string]interface{}, expected []string) []string {
+	exp := map[string]bool{}
+	for _, tn := range expected {
+		exp[tn] = true
+	}
+	rlt := []string{}
+	for k, t := range decl {
+		if !isTenant(t) || exp[k] {
+			continue
+		}
+		tenant := t.(map[string]interface{})
+		if tenant["label"] != TenantLabel || tenant["remark"] != ownerRemark() {
+			continue
+		}
+		for _, app := range tenant {
+			if isApplication(app) {
+				rlt = append(rlt, k)
+				break
+			}
+		}
+	}
+	sort.Strings(rlt)
+	return rlt
+}
+
+func isApplication(a interface{}) bool {
+	app, ok := a.(map[string]interface{})
+	return ok && app["class"] == "Application"
+}
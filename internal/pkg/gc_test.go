@@ -0,0 +1,62 @@
+package pkg
+
+import (
+	"reflect"
+	"testing"
+)
+
+func Test_orphanTenants(t *testing.T) {
+	ClusterName, InstanceID = "cluster1", "f5.io/gateway-controller-name"
+	defer func() { ClusterName, InstanceID = "", "" }()
+
+	app := map[string]interface{}{"class": "Application"}
+	owned := func(apps ...interface{}) map[string]interface{} {
+		tenant := map[string]interface{}{"class": "Tenant", "label": TenantLabel, "remark": ownerRemark()}
+		for _, a := range apps {
+			tenant["serviceMain"] = a
+		}
+		return tenant
+	}
+	decl := map[string]interface{}{
+		"class":         "ADC",
+		"schemaVersion": "3.19.0",
+		"updateMode":    "selective",
+		"gwc-deleted":   owned(app),
+		"gwc-active":    owned(app),
+		"ns-deleted":    owned(app),
+		"ns-active":     owned(app),
+		"ns-empty":      owned(),
+		"cluster2":      map[string]interface{}{"class": "Tenant", "label": TenantLabel, "remark": "cluster2/f5.io/gateway-controller-name", "serviceMain": app},
+		"legacy":        map[string]interface{}{"class": "Tenant", "label": TenantLabel, "serviceMain": app},
+		"others":        map[string]interface{}{"class": "Tenant", "label": "cis", "serviceMain": app},
+		"manual":        map[string]interface{}{"class": "Tenant", "serviceMain": app},
+	}
+
+	orphans := orphanTenants(decl, []string{"gwc-active", "ns-active"})
+	expected := []string{"gwc-deleted", "ns-deleted"}
+	if !reflect.DeepEqual(orphans, expected) {
+		t.Errorf("expected %v, got %v", expected, orphans)
+	}
+}
+
+func Test_foreignTenant(t *testing.T) {
+	ClusterName, InstanceID = "cluster1", "f5.io/gateway-controller-name"
+	defer func() { ClusterName, InstanceID = "", "" }()
+
+	app := map[string]interface{}{"class": "Application"}
+	for name, c := range map[string]struct {
+		existing interface{}
+		foreign  bool
+	}{
+		"notexisting": {nil, false},
+		"owned":       {map[string]interface{}{"class": "Tenant", "label": TenantLabel, "remark": "cluster1/f5.io/gateway-controller-name", "serviceMain": app}, false},
+		"legacy":      {map[string]interface{}{"class": "Tenant", "label": TenantLabel, "serviceMain": app}, false},
+		"cluster2":    {map[string]interface{}{"class": "Tenant", "label": TenantLabel, "remark": "cluster2/f5.io/gateway-controller-name", "serviceMain": app}, true},
+		"cis":         {map[string]interface{}{"class": "Tenant", "serviceMain": app}, true},
+		"empty":       {map[string]interface{}{"class": "Tenant"}, false},
+	} {
+		if err := foreignTenant(name, c.existing); (err != nil) != c.foreign {
+			t.Errorf("%s: expected foreign %t, got %v", name, c.foreign, err)
+		}
+	}
+}
@@ -197,7 +197,7 @@ func parsePoolweight(backends []gatewayapi.HTTPBackendRef, hr *gatewayapi.HTTPRo
 			continue
 		}
 		// pn := strings.Join([]string{ns, string(br.Name)}, ".")
-		pool := fmt.Sprintf("/%s/serviceMain/%s", ns, string(br.Name))
+		pool := fmt.Sprintf("/%s/serviceMain/%s", tenantName(ns), string(br.Name))
 		weight := 1
 		if br.Weight != nil {
 			weight = int(*br.Weight)
@@ -211,7 +211,7 @@ func parsePoolweight(backends []gatewayapi.HTTPBackendRef, hr *gatewayapi.HTTPRo
 func parseiRulesFrom(className string, hr *gatewayapi.HTTPRoute, rlt map[string]interface{}) error {
 	var tpl bytes.Buffer
 	if err := iruleTemplate.ExecuteTemplate(&tpl, "irule.tmpl", hr); err != nil {
-		return fmt.Errorf("cannot parse HttpRoute to iRule by template irule.tmpl")
+		return fmt.Errorf("cannot parse HttpRoute to iRule by template irule.tmpl: %s", err.Error())
 	}
 
 	name := hrName(hr)
@@ -0,0 +1,46 @@
+package pkg
+
+import (
+	"context"
+	"sync"
+
+	"github.com/f5devcentral/f5-bigip-rest-go/utils"
+)
+
+// LeaderTasks is a manager.Runnable needing leader election, it runs the goroutines writing to BIG-IPs,
+// e.g. the deployers, the garbage collector and the initial sync, only on the replica holding the leadership.
+// The goroutines are stopped on leadership loss or shutdown, and Start returns once they all return.
+type LeaderTasks struct {
+	tasks []func(stopCh chan struct{})
+}
+
+// Go adds the task to run on leadership, the task must return soon after stopCh is closed.
+func (lt *LeaderTasks) Go(task func(stopCh chan struct{})) {
+	lt.tasks = append(lt.tasks, task)
+}
+
+func (lt *LeaderTasks) Start(ctx context.Context) error {
+	slog := utils.LogFromContext(NewContext())
+	slog.Infof("started leading, running %d tasks", len(lt.tasks))
+
+	stopCh := make(chan struct{})
+	wg := sync.WaitGroup{}
+	for _, task := range lt.tasks {
+		wg.Add(1)
+		go func(task func(chan struct{})) {
+			defer wg.Done()
+			task(stopCh)
+		}(task)
+	}
+
+	<-ctx.Done()
+	slog.Infof("stopped leading, waiting for the tasks to stop")
+	close(stopCh)
+	wg.Wait()
+	slog.Infof("all leader tasks stopped")
+	return nil
+}
+
+func (lt *LeaderTasks) NeedLeaderElection() bool {
+	return true
+}
@@ -0,0 +1,45 @@
+package pkg
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	f5_bigip "github.com/f5devcentral/f5-bigip-rest-go/bigip"
+	"github.com/f5devcentral/f5-bigip-rest-go/utils"
+)
+
+func TestLeaderTasks(t *testing.T) {
+	PendingDeploys = utils.NewDeployQueue()
+	defer func() { PendingDeploys = nil }()
+
+	started := make(chan struct{})
+	lt := &LeaderTasks{}
+	lt.Go(func(chan struct{}) { close(started) })
+	lt.Go(func(stopCh chan struct{}) { AS3Deployer(stopCh, []*f5_bigip.BIGIP{{URL: "https://bigip"}}) })
+	if lt.NeedLeaderElection() != true {
+		t.Fatalf("expected leader tasks to need leader election")
+	}
+
+	ctx, cancel := context.WithCancel(context.TODO())
+	done := make(chan error)
+	go func() { done <- lt.Start(ctx) }()
+	select {
+	case <-started:
+	case <-time.After(time.Second):
+		t.Fatalf("expected the tasks started")
+	}
+
+	cancel()
+	select {
+	case err := <-done:
+		if err != nil {
+			t.Fatalf("unexpected error: %s", err.Error())
+		}
+	case <-time.After(time.Second):
+		t.Fatalf("expected the deployers stopped on losing leadership")
+	}
+	if w := workers()[0]; !w.stopped() || !w.superseded([]string{"ns1"}) {
+		t.Errorf("expected the in-flight deployment of the stopped worker superseded")
+	}
+}
@@ -0,0 +1,154 @@
+package pkg
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strings"
+
+	"github.com/f5devcentral/f5-bigip-rest-go/utils"
+)
+
+// patchMembers updates the pool members of the tenants whose declarations differ from the applied ones
+// in pool members only, directly over iControl REST instead of deploying the whole tenant via AS3.
+// It returns the results of the tenants patched, the others, including the failed ones, are left to AS3.
+//
+// The declaration stored by AS3 and the nodes of the removed members are left behind until the next
+// full declaration of the tenant, which is deployed via AS3 once the member updates stop, see syncLater.
+func (w *bigipWorker) patchMembers(ctx context.Context, tenants map[string]interface{}) map[string]error {
+	slog := utils.LogFromContext(ctx)
+	rlt := map[string]error{}
+	for k, t := range tenants {
+		base := w.appliedDecl(k)
+		if base == nil {
+			continue
+		}
+		pools, ok := memberChanges(base, t)
+		if !ok {
+			continue
+		}
+		if err := w.patchPools(k, pools); err != nil {
+			slog.Warnf("failed to update pool members of tenant %s on %s, deploying the tenant: %s", k, w.bigip.URL, err.Error())
+			continue
+		}
+		slog.Debugf("updated members of %d pools of tenant %s on %s", len(pools), k, w.bigip.URL)
+		rlt[k] = nil
+	}
+	return rlt
+}
+
+func (w *bigipWorker) patchPools(tenant string, pools map[string][]interface{}) error {
+	for key, members := range pools {
+		app, pool, _ := strings.Cut(key, "/")
+		if err := w.as3.patchPoolMembers(tenant, app, pool, bigipMembers(tenant, members)); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// appliedDecl returns the declaration of the tenant last deployed successfully, nil if it's not applied.
+func (w *bigipWorker) appliedDecl(tenant string) interface{} {
+	w.mutex.RLock()
+	defer w.mutex.RUnlock()
+
+	t, f := w.appliedDecls[tenant]
+	if !f || w.applied[tenant] != tenantHash(t) {
+		return nil
+	}
+	return t
+}
+
+// memberChanges returns the members of the pools changed from the applied tenant to the desired one,
+// keyed by "<application>/<pool>". It's false if nothing but pool members changes.
+func memberChanges(applied, desired interface{}) (map[string][]interface{}, bool) {
+	a, err := utils.DeepCopy(applied)
+	if err != nil {
+		return nil, false
+	}
+	d, err := utils.DeepCopy(desired)
+	if err != nil {
+		return nil, false
+	}
+	am, dm := poolMembersOf(a), poolMembersOf(d)
+	if !utils.DeepEqual(a, d) || len(am) != len(dm) {
+		return nil, false
+	}
+
+	rlt := map[string][]interface{}{}
+	for k, mbs := range dm {
+		if _, f := am[k]; !f {
+			return nil, false
+		}
+		if !utils.DeepEqual(am[k], mbs) {
+			rlt[k] = mbs
+		}
+	}
+	return rlt, len(rlt) > 0
+}
+
+// poolMembersOf takes the members out of the pools in the tenant, keyed by "<application>/<pool>".
+func poolMembersOf(tenant interface{}) map[string][]interface{} {
+	rlt := map[string][]interface{}{}
+	tn, ok := tenant.(map[string]interface{})
+	if !ok {
+		return rlt
+	}
+	for an, app := range tn {
+		if !isApplication(app) {
+			continue
+		}
+		for pn, obj := range app.(map[string]interface{}) {
+			pool, ok := obj.(map[string]interface{})
+			if !ok || pool["class"] != "Pool" {
+				continue
+			}
+			mbs, _ := pool["members"].([]interface{})
+			rlt[an+"/"+pn] = mbs
+			delete(pool, "members")
+		}
+	}
+	return rlt
+}
+
+// bigipMembers converts the AS3 pool members to the ones of iControl REST, named the same as AS3 does.
+func bigipMembers(tenant string, members []interface{}) []interface{} {
+	rlt := []interface{}{}
+	for _, mb := range members {
+		m, ok := mb.(map[string]interface{})
+		if !ok {
+			continue
+		}
+		port := fmt.Sprintf("%v", m["servicePort"])
+		addrs, _ := m["serverAddresses"].([]interface{})
+		for _, addr := range addrs {
+			sep := ":"
+			if utils.IsIpv6(fmt.Sprintf("%v", addr)) {
+				sep = "."
+			}
+			rlt = append(rlt, map[string]interface{}{
+				"name":    fmt.Sprintf("/%s/%v%s%s", tenant, addr, sep, port),
+				"address": addr,
+			})
+		}
+	}
+	return rlt
+}
+
+// patchPoolMembers replaces the members of the pool in the AS3 application.
+func (ac *as3Client) patchPoolMembers(tenant, app, pool string, members []interface{}) error {
+	b, err := json.Marshal(map[string]interface{}{"members": members})
+	if err != nil {
+		return err
+	}
+	url := fmt.Sprintf("%s/mgmt/tm/ltm/pool/~%s~%s~%s", ac.url, tenant, app, pool)
+	code, resp, err := utils.HttpRequest(ac.client, url, "PATCH", string(b), ac.headers())
+	if err != nil {
+		return err
+	}
+	if code != http.StatusOK {
+		return fmt.Errorf("%d, %s", code, RedactText(string(resp)))
+	}
+	return nil
+}
@@ -0,0 +1,165 @@
+package pkg
+
+import (
+	"context"
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"testing"
+	"time"
+
+	f5_bigip "github.com/f5devcentral/f5-bigip-rest-go/bigip"
+	"github.com/f5devcentral/f5-bigip-rest-go/deployer"
+	"github.com/f5devcentral/f5-bigip-rest-go/utils"
+)
+
+func memberTenant(monitor string, addrs ...string) map[string]interface{} {
+	return map[string]interface{}{
+		"class": "Tenant",
+		"serviceMain": map[string]interface{}{
+			"class": "Application",
+			"svc1": map[string]interface{}{
+				"class":    "Pool",
+				"monitors": []string{monitor},
+				"members": []interface{}{
+					map[string]interface{}{"servicePort": 80, "serverAddresses": addrs},
+				},
+			},
+		},
+	}
+}
+
+func Test_memberChanges(t *testing.T) {
+	if _, ok := memberChanges(memberTenant("tcp", "10.0.0.1"), memberTenant("tcp", "10.0.0.1")); ok {
+		t.Errorf("expected no change of the same tenant")
+	}
+	if _, ok := memberChanges(memberTenant("tcp", "10.0.0.1"), memberTenant("http", "10.0.0.2")); ok {
+		t.Errorf("expected structural change not to be patched")
+	}
+	pools, ok := memberChanges(memberTenant("tcp", "10.0.0.1"), memberTenant("tcp", "10.0.0.1", "fe80::2"))
+	if !ok || len(pools) != 1 || pools["serviceMain/svc1"] == nil {
+		t.Fatalf("expected the members of svc1 changed, got %v", pools)
+	}
+	expected := []interface{}{
+		map[string]interface{}{"name": "/ns1/10.0.0.1:80", "address": "10.0.0.1"},
+		map[string]interface{}{"name": "/ns1/fe80::2.80", "address": "fe80::2"},
+	}
+	if mbs := bigipMembers("ns1", pools["serviceMain/svc1"]); !reflect.DeepEqual(mbs, expected) {
+		t.Errorf("unexpected bigip members: %v", mbs)
+	}
+}
+
+func Test_bigipWorker_patchMembers(t *testing.T) {
+	patched := map[string]interface{}{}
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		b, _ := io.ReadAll(r.Body)
+		if r.Method != "PATCH" || r.URL.Path != "/mgmt/tm/ltm/pool/~ns1~serviceMain~svc1" {
+			w.WriteHeader(http.StatusNotFound)
+			return
+		}
+		json.Unmarshal(b, &patched)
+		w.Write([]byte("{}"))
+	}))
+	defer server.Close()
+
+	w := newBIGIPWorker(&f5_bigip.BIGIP{URL: server.URL})
+	tenants := map[string]interface{}{"ns1": memberTenant("tcp", "10.0.0.1"), "ns2": memberTenant("tcp", "10.0.0.1")}
+	if rlt := w.patchMembers(context.TODO(), tenants); len(rlt) != 0 {
+		t.Fatalf("expected nothing patched before applied, got %v", rlt)
+	}
+	w.deployed(tenants, map[string]error{"ns1": nil, "ns2": nil}, nil)
+
+	tenants = map[string]interface{}{"ns1": memberTenant("tcp", "10.0.0.2"), "ns2": memberTenant("tcp", "10.0.0.2")}
+	rlt := w.patchMembers(context.TODO(), tenants)
+	if err, f := rlt["ns1"]; !f || err != nil {
+		t.Fatalf("expected ns1 patched, got %v", rlt)
+	}
+	if _, f := rlt["ns2"]; f {
+		t.Fatalf("expected ns2 failed to patch and left to AS3, got %v", rlt)
+	}
+	expected := map[string]interface{}{"members": []interface{}{
+		map[string]interface{}{"name": "/ns1/10.0.0.2:80", "address": "10.0.0.2"},
+	}}
+	if !reflect.DeepEqual(patched, expected) {
+		t.Errorf("unexpected patched body: %v", patched)
+	}
+
+	// the patched tenant is re-deployed via AS3 later, and not persisted as applied meanwhile.
+	as3SyncDelay = 10 * time.Millisecond
+	defer func() { as3SyncDelay = time.Minute }()
+	w.desired["ns1"] = tenants["ns1"]
+	w.deployed(map[string]interface{}{"ns1": tenants["ns1"]}, rlt, map[string]bool{"ns1": true})
+	if h := w.appliedHashes()["ns1"]; h != tenantHash(memberTenant("tcp", "10.0.0.1")) {
+		t.Errorf("expected the hash deployed via AS3 persisted for ns1")
+	}
+	deadline := time.Now().Add(time.Second)
+	for w.queue.Len() == 0 && time.Now().Before(deadline) {
+		time.Sleep(10 * time.Millisecond)
+	}
+	r := w.queue.Get().(deployer.DeployRequest)
+	tenants = w.tenantsToDeploy([]deployer.DeployRequest{r})
+	if _, f := tenants["ns1"]; !f || w.appliedDecl("ns1") != nil {
+		t.Fatalf("expected ns1 re-deployed via AS3, got %v", tenants)
+	}
+	w.deployed(tenants, map[string]error{"ns1": nil}, nil)
+	if h := w.appliedHashes()["ns1"]; h != tenantHash(tenants["ns1"]) {
+		t.Errorf("expected ns1 synced with AS3")
+	}
+}
+
+func Test_bigipWorker_handleNext_patchedNotSubmitted(t *testing.T) {
+	submitted := map[string]bool{}
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/mgmt/tm/ltm/pool/~ns1~serviceMain~svc1":
+			w.Write([]byte("{}"))
+		case "/mgmt/shared/appsvcs/declare":
+			var body map[string]interface{}
+			json.NewDecoder(r.Body).Decode(&body)
+			for k, t := range body["declaration"].(map[string]interface{}) {
+				if isTenant(t) {
+					submitted[k] = true
+				}
+			}
+			w.WriteHeader(http.StatusAccepted)
+			w.Write([]byte(`{"id": "task1"}`))
+		case "/mgmt/shared/appsvcs/task/task1":
+			w.Write([]byte(`{"id": "task1", "results": [{"code": 200, "tenant": "ns2", "message": "success"}]}`))
+		default:
+			w.WriteHeader(http.StatusNotFound)
+		}
+	}))
+	defer server.Close()
+
+	MemberFastPath, as3PollInterval = true, 10*time.Millisecond
+	defer func(dq *utils.DeployQueue) {
+		MemberFastPath, as3PollInterval, DoneDeploys = false, time.Second, dq
+	}(DoneDeploys)
+	DoneDeploys = utils.NewDeployQueue()
+
+	w := newBIGIPWorker(&f5_bigip.BIGIP{URL: server.URL})
+	defer w.stopRetry()
+	applied := map[string]interface{}{"ns1": memberTenant("tcp", "10.0.0.1"), "ns2": memberTenant("tcp", "10.0.0.1")}
+	w.deployed(applied, map[string]error{"ns1": nil, "ns2": nil}, nil)
+
+	// ns1 changes in pool members only, ns2 in monitor.
+	as3 := RestToAS3(map[string]interface{}{})
+	as3["declaration"].(map[string]interface{})["ns1"] = memberTenant("tcp", "10.0.0.2")
+	as3["declaration"].(map[string]interface{})["ns2"] = memberTenant("http", "10.0.0.1")
+	w.queue.Add(deployer.DeployRequest{To: &as3, AS3: true, Context: NewContext()})
+	w.handleNext()
+
+	if !reflect.DeepEqual(submitted, map[string]bool{"ns2": true}) {
+		t.Errorf("expected only ns2 submitted to AS3, got %v", submitted)
+	}
+	if resp := DoneDeploys.Get().(deployer.DeployResponse); resp.Status != nil {
+		t.Errorf("unexpected deploy error: %s", resp.Status.Error())
+	}
+	w.mutex.RLock()
+	defer w.mutex.RUnlock()
+	if unsynced := w._unsynced(); !reflect.DeepEqual(unsynced, []string{"ns1"}) {
+		t.Errorf("expected only the patched ns1 left to sync via AS3, got %v", unsynced)
+	}
+}
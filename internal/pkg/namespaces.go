@@ -0,0 +1,92 @@
+package pkg
+
+import (
+	"context"
+	"fmt"
+	"sort"
+	"strings"
+
+	"github.com/f5devcentral/f5-bigip-rest-go/utils"
+	v1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/labels"
+	"sigs.k8s.io/controller-runtime/pkg/cache"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+)
+
+// SetupWatchNamespaces restricts the namespaced resources, i.e. gateways, routes, referencegrants,
+// services, endpoints and secrets, to the comma-separated namespaces, or to the namespaces matching
+// the label selector, which is resolved with reader once at startup. Nothing is restricted if both are empty.
+func SetupWatchNamespaces(ctx context.Context, reader client.Reader, namespaces, selector string) error {
+	if namespaces != "" && selector != "" {
+		return fmt.Errorf("watch namespaces and namespace selector cannot be both set")
+	}
+
+	nss := []string{}
+	if namespaces != "" {
+		for _, ns := range strings.Split(namespaces, ",") {
+			if ns = strings.TrimSpace(ns); ns != "" {
+				nss = append(nss, ns)
+			}
+		}
+		if len(nss) == 0 {
+			return fmt.Errorf("no namespace given in '%s'", namespaces)
+		}
+	} else if selector != "" {
+		sel, err := labels.Parse(selector)
+		if err != nil {
+			return fmt.Errorf("invalid namespace selector '%s': %s", selector, err.Error())
+		}
+		var nsList v1.NamespaceList
+		if err := reader.List(ctx, &nsList, &client.ListOptions{LabelSelector: sel}); err != nil {
+			return fmt.Errorf("failed to list namespaces with selector '%s': %s", selector, err.Error())
+		}
+		for _, ns := range nsList.Items {
+			nss = append(nss, ns.Name)
+		}
+		if len(nss) == 0 {
+			return fmt.Errorf("no namespace matches selector '%s'", selector)
+		}
+	} else {
+		watchNamespaces = nil
+		return nil
+	}
+
+	watchNamespaces = utils.Unified(nss)
+	sort.Strings(watchNamespaces)
+	return nil
+}
+
+// WatchedNamespaces returns the namespaces the namespaced resources are listed from,
+// which is NamespaceAll if not restricted.
+func WatchedNamespaces() []string {
+	if len(watchNamespaces) == 0 {
+		return []string{v1.NamespaceAll}
+	}
+	return watchNamespaces
+}
+
+// IsWatchedNamespace tells if the namespaced resources of ns are watched.
+func IsWatchedNamespace(ns string) bool {
+	if len(watchNamespaces) == 0 {
+		return true
+	}
+	for _, n := range watchNamespaces {
+		if n == ns {
+			return true
+		}
+	}
+	return false
+}
+
+// NamespaceCacheOptions returns the manager's cache.Options.DefaultNamespaces,
+// nil if not restricted. Cluster-scoped resources, e.g. nodes, are not impacted.
+func NamespaceCacheOptions() map[string]cache.Config {
+	if len(watchNamespaces) == 0 {
+		return nil
+	}
+	rlt := map[string]cache.Config{}
+	for _, ns := range watchNamespaces {
+		rlt[ns] = cache.Config{}
+	}
+	return rlt
+}
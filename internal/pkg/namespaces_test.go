@@ -0,0 +1,49 @@
+package pkg
+
+import (
+	"context"
+	"reflect"
+	"testing"
+
+	v1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"sigs.k8s.io/controller-runtime/pkg/client/fake"
+)
+
+func Test_SetupWatchNamespaces(t *testing.T) {
+	defer func() { watchNamespaces = nil }()
+
+	namespace := func(n string, lbs map[string]string) *v1.Namespace {
+		return &v1.Namespace{ObjectMeta: metav1.ObjectMeta{Name: n, Labels: lbs}}
+	}
+	cli := fake.NewClientBuilder().WithObjects(
+		namespace("app1", map[string]string{"bigip-gateway": "enabled"}),
+		namespace("app2", map[string]string{"bigip-gateway": "enabled"}),
+		namespace("other", map[string]string{}),
+	).Build()
+	ctx := context.TODO()
+
+	if err := SetupWatchNamespaces(ctx, cli, "", ""); err != nil || !IsWatchedNamespace("other") ||
+		!reflect.DeepEqual(WatchedNamespaces(), []string{v1.NamespaceAll}) || NamespaceCacheOptions() != nil {
+		t.Fatalf("expected all namespaces watched, got %v, %v", WatchedNamespaces(), err)
+	}
+
+	if err := SetupWatchNamespaces(ctx, cli, "app2, app1,app2", ""); err != nil ||
+		!reflect.DeepEqual(WatchedNamespaces(), []string{"app1", "app2"}) || IsWatchedNamespace("other") {
+		t.Fatalf("expected app1 and app2 watched, got %v, %v", WatchedNamespaces(), err)
+	}
+	if opts := NamespaceCacheOptions(); len(opts) != 2 {
+		t.Fatalf("expected cache options of 2 namespaces, got %v", opts)
+	}
+
+	if err := SetupWatchNamespaces(ctx, cli, "", "bigip-gateway=enabled"); err != nil ||
+		!reflect.DeepEqual(WatchedNamespaces(), []string{"app1", "app2"}) {
+		t.Fatalf("expected the selected app1 and app2 watched, got %v, %v", WatchedNamespaces(), err)
+	}
+
+	for _, c := range [][2]string{{"app1", "bigip-gateway=enabled"}, {" , ", ""}, {"", "bigip-gateway=none"}, {"", "a=("}} {
+		if err := SetupWatchNamespaces(ctx, cli, c[0], c[1]); err == nil {
+			t.Fatalf("expected error for namespaces '%s' and selector '%s'", c[0], c[1])
+		}
+	}
+}
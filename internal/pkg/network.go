@@ -0,0 +1,497 @@
+package pkg
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/f5devcentral/bigip-kubernetes-gateway/internal/k8s"
+	f5_bigip "github.com/f5devcentral/f5-bigip-rest-go/bigip"
+	"github.com/f5devcentral/f5-bigip-rest-go/utils"
+)
+
+// RequestNetSync notifies NetDeployer to reconcile the network resources, requests are coalesced.
+func RequestNetSync() {
+	select {
+	case netSyncCh <- struct{}{}:
+	default:
+	}
+}
+
+// ParseNetworkResources parses the tunnel fdb records, static arps, static routes and bgp neighbors
+// needed for reaching pod IP members from BIG-IP, the arps of the services failed to parse are skipped.
+func ParseNetworkResources() (map[string]interface{}, error) {
+	defer utils.TimeItToPrometheus()()
+
+	rlt := map[string]interface{}{}
+	nodes := k8s.NodeCache.All()
+	parseFdbsFrom(nodes, rlt)
+	parseRoutesFrom(nodes, rlt)
+	for _, kn := range ActiveSIGs.AllAttachedServiceKeys() {
+		ns, n := strings.Split(kn, "/")[0], strings.Split(kn, "/")[1]
+		if err := parseArpsFrom(ns, n, rlt); err != nil {
+			// only the arps of the failed service are skipped, the other network resources are still reconciled.
+			utils.LogFromContext(context.TODO()).Warnf("skipped arps of service %s: %s", kn, err.Error())
+			if utils.NeedRetry(err) {
+				time.AfterFunc(time.Second, RequestNetSync)
+			}
+			continue
+		}
+	}
+	return rlt, nil
+}
+
+// NetDeployer reconciles the network resources to the BIG-IPs whose network settings are configured,
+// whenever RequestNetSync is called:
+//
+// vxlan tunnel fdb records and static arps if network.vxlanTunnel is set;
+// static routes or bgp neighbors of calico nodes if network.routeMode is set.
+func NetDeployer(stopCh chan struct{}, bigips []*f5_bigip.BIGIP, configs BIGIPConfigs) {
+	applied := map[string]map[string]interface{}{}
+	dirty := map[string]bool{}
+	// the fdb records applied before restart, the records of tunnels are not told from the ones of others otherwise.
+	for _, bip := range bigips {
+		if fdbs := appliedFdbs(NewContext(), bip.URL); len(fdbs) > 0 {
+			applied[bip.URL] = fdbs
+		}
+	}
+
+	handleNext := func() {
+		ctx := NewContext()
+		slog := utils.LogFromContext(ctx)
+
+		cfgs, err := ParseNetworkResources()
+		if err != nil {
+			slog.Errorf("failed to parse network resources: %s", err.Error())
+			if utils.NeedRetry(err) {
+				time.AfterFunc(time.Second, RequestNetSync)
+			}
+			return
+		}
+
+		for i, bip := range bigips {
+			if i >= len(configs) {
+				continue
+			}
+			netcfg := configs[i].Network
+			if netcfg.VxlanTunnel == "" && netcfg.VxlanTunnelV6 == "" && netcfg.RouteMode == "" {
+				continue
+			}
+			if oldcfgs, f := applied[bip.URL]; f && !dirty[bip.URL] && utils.DeepEqual(oldcfgs, cfgs) {
+				continue
+			}
+			bc := &f5_bigip.BIGIPContext{Context: ctx, BIGIP: *bip}
+			if err := deployNetwork(bc, &netcfg, applied[bip.URL], cfgs); err != nil {
+				slog.Errorf("failed to deploy network resources to %s: %s", bip.URL, err.Error())
+				dirty[bip.URL] = true
+				time.AfterFunc(5*time.Second, RequestNetSync)
+			} else {
+				applied[bip.URL] = cfgs
+				dirty[bip.URL] = false
+				persistFdbs(ctx, bip.URL, cfgs)
+			}
+		}
+	}
+
+	for {
+		select {
+		case <-stopCh:
+			return
+		case <-netSyncCh:
+			handleNext()
+		}
+	}
+}
+
+func deployNetwork(bc *f5_bigip.BIGIPContext, netcfg *BIGIPNetworkConfig, ocfgs, ncfgs map[string]interface{}) error {
+	nress := splitNetResources(ncfgs)
+
+	oress := splitNetResources(ocfgs)
+	if netcfg.VxlanTunnel != "" {
+		if err := deployFdbs(bc, netcfg.VxlanTunnel, oress["net/fdb"], nress["net/fdb"]); err != nil {
+			return err
+		}
+	}
+	if netcfg.VxlanTunnelV6 != "" {
+		if err := deployFdbs(bc, netcfg.VxlanTunnelV6, oress["net/fdb-v6"], nress["net/fdb-v6"]); err != nil {
+			return err
+		}
+	}
+	if netcfg.VxlanTunnel != "" || netcfg.VxlanTunnelV6 != "" {
+		if err := deployNamed(bc, "net/arp", networkPrefix(), nress["net/arp"], "macAddress"); err != nil {
+			return err
+		}
+		if err := deployNamed(bc, "net/ndp", networkPrefix(), nress["net/ndp"], "macAddress"); err != nil {
+			return err
+		}
+	}
+
+	switch netcfg.RouteMode {
+	case "":
+	case RouteMode_Static:
+		return deployNamed(bc, "net/route", networkPrefix(), nress["net/route"], "network", "gw")
+	case RouteMode_BGP:
+		return deployBGPNeighbors(bc, netcfg, oress["net/bgp-neighbor"], nress["net/bgp-neighbor"])
+	default:
+		return fmt.Errorf("unknown route mode: %s", netcfg.RouteMode)
+	}
+	return nil
+}
+
+// splitNetResources splits the network resources by type, e.g. net/arp.
+func splitNetResources(cfgs map[string]interface{}) map[string]map[string]interface{} {
+	rlt := map[string]map[string]interface{}{}
+	for tn, res := range cfgs {
+		t, n := typeAndName(tn)
+		if _, f := rlt[t]; !f {
+			rlt[t] = map[string]interface{}{}
+		}
+		rlt[t][n] = res
+	}
+	return rlt
+}
+
+// deployFdbs reconciles the records of the tunnel owned by the controller, i.e. the desired ones and the ones
+// deployed last time, the other records of the tunnel are left untouched.
+func deployFdbs(bc *f5_bigip.BIGIPContext, tunnel string, ofdbs, nfdbs map[string]interface{}) error {
+	slog := utils.LogFromContext(bc)
+
+	partition, name := splitFullPath(tunnel)
+	records := fmt.Sprintf("/mgmt/tm/net/fdb/tunnel/~%s~%s/records", partition, name)
+	existings, err := existingFdbs(bc, partition, name)
+	if err != nil {
+		return fmt.Errorf("failed to get fdb records of tunnel %s: %s", tunnel, err.Error())
+	}
+
+	crts, mods, dels := diffFdbs(existings, ofdbs, nfdbs)
+	for _, n := range crts {
+		slog.Debugf("creating fdb record %s of tunnel %s", n, tunnel)
+		if err := bc.Restcall(records, "POST", nil, nfdbs[n].(map[string]interface{})); err != nil {
+			return fmt.Errorf("failed to create fdb record %s of tunnel %s: %s", n, tunnel, err.Error())
+		}
+	}
+	for _, n := range mods {
+		slog.Debugf("updating fdb record %s of tunnel %s", n, tunnel)
+		body := map[string]interface{}{"endpoint": nfdbs[n].(map[string]interface{})["endpoint"]}
+		if err := bc.Restcall(records+"/"+n, "PATCH", nil, body); err != nil {
+			return fmt.Errorf("failed to update fdb record %s of tunnel %s: %s", n, tunnel, err.Error())
+		}
+	}
+	for _, n := range dels {
+		slog.Debugf("deleting fdb record %s of tunnel %s", n, tunnel)
+		if err := bc.Restcall(records+"/"+n, "DELETE", nil, nil); err != nil {
+			return fmt.Errorf("failed to delete fdb record %s of tunnel %s: %s", n, tunnel, err.Error())
+		}
+	}
+	return nil
+}
+
+// existingFdbs returns the records of the tunnel, in format of name -> endpoint.
+func existingFdbs(bc *f5_bigip.BIGIPContext, partition, name string) (map[string]string, error) {
+	ressp, err := bc.All(fmt.Sprintf("net/fdb/tunnel/~%s~%s/records", partition, name))
+	if err != nil {
+		return nil, err
+	}
+	rlt := map[string]string{}
+	items, _ := (*ressp)["items"].([]interface{})
+	for _, i := range items {
+		mi, ok := i.(map[string]interface{})
+		if !ok {
+			continue
+		}
+		n, _ := mi["name"].(string)
+		ep, _ := mi["endpoint"].(string)
+		rlt[n] = ep
+	}
+	return rlt, nil
+}
+
+// diffFdbs returns the records to create, to update and to delete, only the ones deployed last time
+// are deleted if not desired any more. The records deployed before restart are known from the applied
+// state store, see appliedFdbs.
+func diffFdbs(existings map[string]string, ofdbs, nfdbs map[string]interface{}) ([]string, []string, []string) {
+	crts, mods, dels := []string{}, []string{}, []string{}
+	for n, r := range nfdbs {
+		ep := fmt.Sprintf("%v", r.(map[string]interface{})["endpoint"])
+		if eep, f := existings[n]; !f {
+			crts = append(crts, n)
+		} else if eep != ep {
+			mods = append(mods, n)
+		}
+	}
+	for n := range ofdbs {
+		if _, f := nfdbs[n]; !f {
+			if _, f := existings[n]; f {
+				dels = append(dels, n)
+			}
+		}
+	}
+	sort.Strings(crts)
+	sort.Strings(mods)
+	sort.Strings(dels)
+	return crts, mods, dels
+}
+
+// fdbStoreKey returns the key of the fdb records applied to the BIG-IP in the applied state store.
+func fdbStoreKey(url string) string {
+	return url + "/fdbs"
+}
+
+// appliedFdbs loads the fdb records persisted by persistFdbs, so that the records of the nodes removed
+// while the controller is down are still deleted after restart.
+func appliedFdbs(ctx context.Context, url string) map[string]interface{} {
+	rlt := map[string]interface{}{}
+	if appliedStore == nil {
+		return rlt
+	}
+	records, err := appliedStore.loadFor(ctx, fdbStoreKey(url))
+	if err != nil {
+		utils.LogFromContext(ctx).Warnf("failed to load applied fdb records of %s: %s", url, err.Error())
+		return rlt
+	}
+	for tn, ep := range records {
+		_, n := typeAndName(tn)
+		rlt[tn] = map[string]interface{}{
+			"name":     n,
+			"endpoint": ep,
+		}
+	}
+	return rlt
+}
+
+// persistFdbs saves the fdb records of cfgs applied to the BIG-IP, in format of {"net/fdb/<mac>": "<endpoint>"}.
+func persistFdbs(ctx context.Context, url string, cfgs map[string]interface{}) {
+	if appliedStore == nil {
+		return
+	}
+	records := map[string]string{}
+	for tn, r := range cfgs {
+		if t, _ := typeAndName(tn); t == "net/fdb" || t == "net/fdb-v6" {
+			records[tn] = fmt.Sprintf("%v", r.(map[string]interface{})["endpoint"])
+		}
+	}
+	if err := appliedStore.save(ctx, fdbStoreKey(url), records); err != nil {
+		utils.LogFromContext(ctx).Warnf("failed to persist applied fdb records of %s: %s", url, err.Error())
+	}
+}
+
+// deployNamed reconciles the Common resources of the kind whose names start with prefix,
+// the resources are compared with the given fields, and modified in place if changed.
+func deployNamed(bc *f5_bigip.BIGIPContext, kind, prefix string, desired map[string]interface{}, fields ...string) error {
+	slog := utils.LogFromContext(bc)
+
+	existings, err := existingNamed(bc, kind, prefix, fields...)
+	if err != nil {
+		return err
+	}
+	crts, mods, dels := diffNamed(existings, fingerprints(desired, fields...))
+	for _, n := range crts {
+		slog.Debugf("creating %s %s", kind, n)
+		body := map[string]interface{}{}
+		for k, v := range desired[n].(map[string]interface{}) {
+			body[k] = v
+		}
+		if err := bc.Deploy(kind, n, "Common", "", body); err != nil {
+			return fmt.Errorf("failed to create %s %s: %s", kind, n, err.Error())
+		}
+	}
+	for _, n := range mods {
+		slog.Debugf("modifying %s %s", kind, n)
+		body := map[string]interface{}{}
+		for _, f := range fields {
+			body[f] = desired[n].(map[string]interface{})[f]
+		}
+		if err := bc.Update(kind, n, "Common", "", body); err != nil {
+			return fmt.Errorf("failed to modify %s %s: %s", kind, n, err.Error())
+		}
+	}
+	for _, n := range dels {
+		slog.Debugf("deleting %s %s", kind, n)
+		if err := bc.Delete(kind, n, "Common", ""); err != nil {
+			return fmt.Errorf("failed to delete %s %s: %s", kind, n, err.Error())
+		}
+	}
+	return nil
+}
+
+// existingNamed returns the Common resources of the kind whose names start with prefix,
+// in format of name -> fingerprint of the given fields.
+func existingNamed(bc *f5_bigip.BIGIPContext, kind, prefix string, fields ...string) (map[string]string, error) {
+	ressp, err := bc.All(kind)
+	if err != nil {
+		return nil, err
+	}
+	items, ok := (*ressp)["items"].([]interface{})
+	if !ok {
+		return map[string]string{}, nil
+	}
+	existings := map[string]interface{}{}
+	for _, i := range items {
+		mi := i.(map[string]interface{})
+		name, _ := mi["name"].(string)
+		partition, _ := mi["partition"].(string)
+		if partition != "Common" || !strings.HasPrefix(name, prefix) {
+			continue
+		}
+		existings[name] = mi
+	}
+	return fingerprints(existings, fields...), nil
+}
+
+func fingerprints(ress map[string]interface{}, fields ...string) map[string]string {
+	rlt := map[string]string{}
+	for n, res := range ress {
+		values := []string{}
+		for _, f := range fields {
+			values = append(values, fmt.Sprintf("%v", res.(map[string]interface{})[f]))
+		}
+		rlt[n] = strings.Join(values, ",")
+	}
+	return rlt
+}
+
+// diffNamed returns the names to create, to modify and to delete.
+func diffNamed(existings, desired map[string]string) ([]string, []string, []string) {
+	crts, mods, dels := []string{}, []string{}, []string{}
+	for n := range existings {
+		if _, f := desired[n]; !f {
+			dels = append(dels, n)
+		}
+	}
+	for n, dfp := range desired {
+		if fp, f := existings[n]; !f {
+			crts = append(crts, n)
+		} else if dfp != fp {
+			mods = append(mods, n)
+		}
+	}
+	sort.Strings(crts)
+	sort.Strings(mods)
+	sort.Strings(dels)
+	return crts, mods, dels
+}
+
+// deployBGPNeighbors configures the ZebOS bgp neighbors via imish. The neighbors are kept in
+// the peer-group named after the network prefix, so that the ones managed by the controller are
+// read back from the running config, the members of the group or the neighbors deployed last time
+// but not desired any more are unset, while all the desired ones are (re)set.
+func deployBGPNeighbors(bc *f5_bigip.BIGIPContext, netcfg *BIGIPNetworkConfig, oneighbors, nneighbors map[string]interface{}) error {
+	localAS, remoteAS := netcfg.BGP.LocalAS, netcfg.BGP.RemoteAS
+	if localAS == 0 {
+		return fmt.Errorf("network.bgp.localAS is not set")
+	}
+	if remoteAS == 0 {
+		remoteAS = localAS
+	}
+
+	group := bgpPeerGroup()
+	existings, err := groupedNeighbors(bc, netcfg.BGP.RouteDomain, group)
+	if err != nil {
+		return fmt.Errorf("failed to read bgp neighbors: %s", err.Error())
+	}
+	for n := range oneighbors {
+		existings[n] = true
+	}
+	dels, neighbors := []string{}, []string{}
+	for n := range existings {
+		if _, f := nneighbors[n]; !f {
+			dels = append(dels, n)
+		}
+	}
+	for n := range nneighbors {
+		neighbors = append(neighbors, n)
+	}
+	sort.Strings(dels)
+	sort.Strings(neighbors)
+
+	body := imishBody(netcfg.BGP.RouteDomain, bgpCommands(localAS, remoteAS, group, dels, neighbors))
+	if err := bc.Restcall("/mgmt/tm/util/bash", "POST", nil, body); err != nil {
+		return fmt.Errorf("failed to configure bgp neighbors: %s", err.Error())
+	}
+	return nil
+}
+
+// bgpPeerGroup is the ZebOS peer-group holding the bgp neighbors managed by the controller.
+func bgpPeerGroup() string {
+	return strings.TrimRight(networkPrefix(), "-_")
+}
+
+// bgpCommands generates the imish commands to unset the neighbors dels and to set the neighbors
+// in the peer-group.
+func bgpCommands(localAS, remoteAS int, group string, dels, neighbors []string) []string {
+	cmds := []string{
+		"configure terminal",
+		fmt.Sprintf("router bgp %d", localAS),
+		fmt.Sprintf("neighbor %s peer-group", group),
+	}
+	for _, n := range dels {
+		cmds = append(cmds, fmt.Sprintf("no neighbor %s", n))
+	}
+	for _, n := range neighbors {
+		cmds = append(cmds,
+			fmt.Sprintf("neighbor %s remote-as %d", n, remoteAS),
+			fmt.Sprintf("neighbor %s peer-group %s", n, group),
+		)
+	}
+	return append(cmds, "end", "write")
+}
+
+func imishBody(routeDomain int, cmds []string) map[string]interface{} {
+	args := []string{fmt.Sprintf("imish -r %d", routeDomain)}
+	for _, c := range cmds {
+		args = append(args, fmt.Sprintf(`-e "%s"`, c))
+	}
+	return map[string]interface{}{
+		"command":     "run",
+		"utilCmdArgs": fmt.Sprintf("-c '%s'", strings.Join(args, " ")),
+	}
+}
+
+// groupedNeighbors reads the members of the peer-group from the ZebOS running config.
+func groupedNeighbors(bc *f5_bigip.BIGIPContext, routeDomain int, group string) (map[string]bool, error) {
+	b, err := json.Marshal(imishBody(routeDomain, []string{"show running-config"}))
+	if err != nil {
+		return nil, err
+	}
+	ac := newAS3Client(bc.URL, bc.Authorization)
+	code, resp, err := utils.HttpRequest(ac.client, bc.URL+"/mgmt/tm/util/bash", "POST", string(b), ac.headers())
+	if err != nil {
+		return nil, err
+	}
+	if code != http.StatusOK {
+		return nil, fmt.Errorf("%d, %s", code, RedactText(string(resp)))
+	}
+	var rlt struct {
+		CommandResult string `json:"commandResult"`
+	}
+	if err := json.Unmarshal(resp, &rlt); err != nil {
+		return nil, err
+	}
+	return parseGroupedNeighbors(rlt.CommandResult, group), nil
+}
+
+// parseGroupedNeighbors picks the neighbors of the peer-group out of the running config, i.e.
+// the lines of "neighbor <address> peer-group <group>".
+func parseGroupedNeighbors(config, group string) map[string]bool {
+	rlt := map[string]bool{}
+	for _, line := range strings.Split(config, "\n") {
+		fs := strings.Fields(line)
+		if len(fs) == 4 && fs[0] == "neighbor" && fs[2] == "peer-group" && fs[3] == group {
+			rlt[fs[1]] = true
+		}
+	}
+	return rlt
+}
+
+// splitFullPath splits BIG-IP full path like /Common/fl-vxlan to partition and name.
+func splitFullPath(path string) (string, string) {
+	a := strings.Split(strings.TrimPrefix(path, "/"), "/")
+	if len(a) == 1 {
+		return "Common", a[0]
+	}
+	return a[0], a[len(a)-1]
+}
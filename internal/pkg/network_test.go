@@ -0,0 +1,283 @@
+package pkg
+
+import (
+	"context"
+	"reflect"
+	"testing"
+
+	"github.com/f5devcentral/bigip-kubernetes-gateway/internal/k8s"
+	v1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"sigs.k8s.io/controller-runtime/pkg/client/fake"
+
+	gatewayapi "sigs.k8s.io/gateway-api/apis/v1"
+)
+
+func Test_parseFdbsFrom(t *testing.T) {
+	nodes := map[string]k8s.K8Node{
+		"node1": {Name: "node1", IpAddr: "10.0.0.1", NetType: "vxlan", MacAddr: "aa:aa:aa:aa:aa:01"},
+		"node2": {Name: "node2", IpAddr: "10.0.0.2", NetType: "calico-underlay"},
+		"node3": {Name: "node3", IpAddr: "10.0.0.3", NetType: "vxlan"},
+		"node4": {Name: "node4", IpAddrV6: "fd00::4", NetType: "vxlan", MacAddrV6: "bb:bb:bb:bb:bb:04"},
+	}
+	rlt := map[string]interface{}{}
+	parseFdbsFrom(nodes, rlt)
+
+	expected := map[string]interface{}{
+		"net/fdb/aa:aa:aa:aa:aa:01": map[string]interface{}{
+			"name":     "aa:aa:aa:aa:aa:01",
+			"endpoint": "10.0.0.1",
+		},
+		"net/fdb-v6/bb:bb:bb:bb:bb:04": map[string]interface{}{
+			"name":     "bb:bb:bb:bb:bb:04",
+			"endpoint": "fd00::4",
+		},
+	}
+	if !reflect.DeepEqual(rlt, expected) {
+		t.Errorf("expected %v, got %v", expected, rlt)
+	}
+}
+
+func Test_ParseNetworkResources_skipFailedService(t *testing.T) {
+	saved := ActiveSIGs
+	defer func() { ActiveSIGs = saved }()
+	ActiveSIGs = benchmarkCache(20)
+
+	node := v1.Node{
+		ObjectMeta: metav1.ObjectMeta{
+			Name: "node1",
+			Annotations: map[string]string{
+				"flannel.alpha.coreos.com/backend-data": `{"VtepMAC":"aa:aa:aa:aa:aa:01"}`,
+				"flannel.alpha.coreos.com/public-ip":    "10.0.0.1",
+				"flannel.alpha.coreos.com/backend-type": "vxlan",
+			},
+		},
+		Status: v1.NodeStatus{Conditions: []v1.NodeCondition{{Reason: "FlannelIsUp"}}},
+	}
+	if err := k8s.NodeCache.Set(&node); err != nil {
+		t.Fatalf("failed to set node: %s", err.Error())
+	}
+	defer k8s.NodeCache.Unset("node1")
+
+	// svc0 is referred by gwc and gwc-np of different member modes, svc10 by gwc only.
+	sn := gatewayapi.SectionName("https")
+	ActiveSIGs.SetGatewayClass(&gatewayapi.GatewayClass{ObjectMeta: metav1.ObjectMeta{
+		Name:        "gwc-np",
+		Annotations: map[string]string{Annotation_MemberMode: k8s.MemberMode_NodePort},
+	}})
+	gw := ActiveSIGs.GetGateway("ns0/gw0").DeepCopy()
+	gw.Name, gw.Spec.GatewayClassName = "gw-np", "gwc-np"
+	ActiveSIGs.SetGateway(gw)
+	hr := ActiveSIGs.GetHTTPRoute("ns0/hr0").DeepCopy()
+	hr.Name, hr.Spec.ParentRefs = "hr-np", []gatewayapi.ParentReference{{Name: "gw-np", SectionName: &sn}}
+	ActiveSIGs.SetHTTPRoute(hr)
+	nodeName := "node1"
+	for i, n := range []string{"svc0", "svc10"} {
+		ActiveSIGs.GetService("ns0/" + n).Spec.Type = v1.ServiceTypeClusterIP
+		ActiveSIGs.SetEndpoints(&v1.Endpoints{
+			ObjectMeta: metav1.ObjectMeta{Namespace: "ns0", Name: n},
+			Subsets: []v1.EndpointSubset{{
+				Addresses: []v1.EndpointAddress{{IP: []string{"10.244.1.10", "10.244.1.11"}[i], NodeName: &nodeName}},
+				Ports:     []v1.EndpointPort{{Port: 80}},
+			}},
+		})
+	}
+
+	rlt, err := ParseNetworkResources()
+	if err != nil {
+		t.Fatalf("expected the conflicting service skipped only, got error: %s", err.Error())
+	}
+	if _, f := rlt["net/arp/"+networkPrefix()+"10.244.1.10"]; f {
+		t.Errorf("expected arp of svc0 of conflicting member modes skipped: %v", rlt)
+	}
+	if _, f := rlt["net/arp/"+networkPrefix()+"10.244.1.11"]; !f {
+		t.Errorf("expected arp of svc10 still parsed: %v", rlt)
+	}
+	if _, f := rlt["net/fdb/aa:aa:aa:aa:aa:01"]; !f {
+		t.Errorf("expected fdb of node1 still parsed: %v", rlt)
+	}
+}
+
+func Test_diffNamed(t *testing.T) {
+	arp := func(ip, mac string) map[string]interface{} {
+		return map[string]interface{}{
+			"name":       networkPrefix() + ip,
+			"ipAddress":  ip,
+			"macAddress": mac,
+		}
+	}
+	existings := map[string]string{
+		networkPrefix() + "172.16.1.10": "aa:aa:aa:aa:aa:01",
+		networkPrefix() + "172.16.1.11": "aa:aa:aa:aa:aa:01",
+		networkPrefix() + "172.16.2.10": "aa:aa:aa:aa:aa:02",
+	}
+	desired := map[string]interface{}{
+		networkPrefix() + "172.16.1.10": arp("172.16.1.10", "aa:aa:aa:aa:aa:01"),
+		networkPrefix() + "172.16.1.11": arp("172.16.1.11", "aa:aa:aa:aa:aa:03"),
+		networkPrefix() + "172.16.3.10": arp("172.16.3.10", "aa:aa:aa:aa:aa:03"),
+	}
+
+	crts, mods, dels := diffNamed(existings, fingerprints(desired, "macAddress"))
+	if !reflect.DeepEqual(crts, []string{networkPrefix() + "172.16.3.10"}) {
+		t.Errorf("unexpected arps to create: %v", crts)
+	}
+	if !reflect.DeepEqual(mods, []string{networkPrefix() + "172.16.1.11"}) {
+		t.Errorf("unexpected arps to modify: %v", mods)
+	}
+	if !reflect.DeepEqual(dels, []string{networkPrefix() + "172.16.2.10"}) {
+		t.Errorf("unexpected arps to delete: %v", dels)
+	}
+}
+
+func Test_diffFdbs(t *testing.T) {
+	record := func(mac, ep string) map[string]interface{} {
+		return map[string]interface{}{"name": mac, "endpoint": ep}
+	}
+	existings := map[string]string{
+		"aa:aa:aa:aa:aa:01": "10.0.0.1",
+		"aa:aa:aa:aa:aa:02": "10.0.0.2",
+		"aa:aa:aa:aa:aa:03": "10.0.0.3",
+		// created by others sharing the tunnel
+		"cc:cc:cc:cc:cc:01": "10.1.0.1",
+	}
+	ofdbs := map[string]interface{}{
+		"aa:aa:aa:aa:aa:01": record("aa:aa:aa:aa:aa:01", "10.0.0.1"),
+		"aa:aa:aa:aa:aa:02": record("aa:aa:aa:aa:aa:02", "10.0.0.2"),
+		"aa:aa:aa:aa:aa:03": record("aa:aa:aa:aa:aa:03", "10.0.0.3"),
+	}
+	nfdbs := map[string]interface{}{
+		"aa:aa:aa:aa:aa:01": record("aa:aa:aa:aa:aa:01", "10.0.0.1"),
+		"aa:aa:aa:aa:aa:02": record("aa:aa:aa:aa:aa:02", "10.0.0.12"),
+		"aa:aa:aa:aa:aa:04": record("aa:aa:aa:aa:aa:04", "10.0.0.4"),
+	}
+
+	crts, mods, dels := diffFdbs(existings, ofdbs, nfdbs)
+	if !reflect.DeepEqual(crts, []string{"aa:aa:aa:aa:aa:04"}) {
+		t.Errorf("unexpected records to create: %v", crts)
+	}
+	if !reflect.DeepEqual(mods, []string{"aa:aa:aa:aa:aa:02"}) {
+		t.Errorf("unexpected records to update: %v", mods)
+	}
+	if !reflect.DeepEqual(dels, []string{"aa:aa:aa:aa:aa:03"}) {
+		t.Errorf("unexpected records to delete, others' records must be kept: %v", dels)
+	}
+}
+
+func Test_diffFdbs_afterRestart(t *testing.T) {
+	saved := appliedStore
+	defer func() { appliedStore = saved }()
+	cli := fake.NewClientBuilder().Build()
+	appliedStore = &configMapStore{reader: cli, writer: cli, namespace: "kube-system", name: "applied"}
+	ctx, url := context.TODO(), "https://10.250.15.180"
+
+	persistFdbs(ctx, url, map[string]interface{}{
+		"net/fdb/aa:aa:aa:aa:aa:01":                  map[string]interface{}{"name": "aa:aa:aa:aa:aa:01", "endpoint": "10.0.0.1"},
+		"net/fdb/aa:aa:aa:aa:aa:02":                  map[string]interface{}{"name": "aa:aa:aa:aa:aa:02", "endpoint": "10.0.0.2"},
+		"net/arp/" + networkPrefix() + "10.244.1.10": map[string]interface{}{},
+	})
+
+	// node2 is removed while the controller is down.
+	existings := map[string]string{
+		"aa:aa:aa:aa:aa:01": "10.0.0.1",
+		"aa:aa:aa:aa:aa:02": "10.0.0.2",
+		// created by others sharing the tunnel
+		"cc:cc:cc:cc:cc:01": "10.1.0.1",
+	}
+	nfdbs := map[string]interface{}{
+		"aa:aa:aa:aa:aa:01": map[string]interface{}{"name": "aa:aa:aa:aa:aa:01", "endpoint": "10.0.0.1"},
+	}
+	ofdbs := splitNetResources(appliedFdbs(ctx, url))["net/fdb"]
+	if len(ofdbs) != 2 {
+		t.Fatalf("expected 2 fdb records loaded after restart, got %v", ofdbs)
+	}
+	crts, mods, dels := diffFdbs(existings, ofdbs, nfdbs)
+	if len(crts) != 0 || len(mods) != 0 {
+		t.Errorf("unexpected records to create or update: %v, %v", crts, mods)
+	}
+	if !reflect.DeepEqual(dels, []string{"aa:aa:aa:aa:aa:02"}) {
+		t.Errorf("expected the record of removed node deleted after restart, got %v", dels)
+	}
+}
+
+func Test_parseRoutesFrom(t *testing.T) {
+	nodes := map[string]k8s.K8Node{
+		"node1": {Name: "node1", IpAddr: "10.0.0.1", NetType: "calico-underlay", PodCIDRs: []string{"10.244.1.0/24", "fd00:10:244:1::/64"}},
+		"node2": {Name: "node2", IpAddr: "10.0.0.2", NetType: "vxlan", PodCIDRs: []string{"10.244.2.0/24"}},
+		"node3": {Name: "node3", IpAddr: "10.0.0.3", IpAddrV6: "fd00::3", NetType: "calico-underlay",
+			PodCIDRs: []string{"10.244.3.0/24", "fd00:10:244:3::/64"}},
+	}
+	rlt := map[string]interface{}{}
+	parseRoutesFrom(nodes, rlt)
+
+	expected := map[string]interface{}{
+		"net/bgp-neighbor/10.0.0.1": map[string]interface{}{
+			"address": "10.0.0.1",
+		},
+		"net/route/" + networkPrefix() + "node1": map[string]interface{}{
+			"name":    networkPrefix() + "node1",
+			"network": "10.244.1.0/24",
+			"gw":      "10.0.0.1",
+		},
+		"net/bgp-neighbor/10.0.0.3": map[string]interface{}{
+			"address": "10.0.0.3",
+		},
+		"net/bgp-neighbor/fd00::3": map[string]interface{}{
+			"address": "fd00::3",
+		},
+		"net/route/" + networkPrefix() + "node3": map[string]interface{}{
+			"name":    networkPrefix() + "node3",
+			"network": "10.244.3.0/24",
+			"gw":      "10.0.0.3",
+		},
+		"net/route/" + networkPrefix() + "node3-1": map[string]interface{}{
+			"name":    networkPrefix() + "node3-1",
+			"network": "fd00:10:244:3::/64",
+			"gw":      "fd00::3",
+		},
+	}
+	if !reflect.DeepEqual(rlt, expected) {
+		t.Errorf("expected %v, got %v", expected, rlt)
+	}
+}
+
+func Test_splitFullPath(t *testing.T) {
+	for path, expected := range map[string][2]string{
+		"/Common/fl-vxlan": {"Common", "fl-vxlan"},
+		"Common/fl-vxlan":  {"Common", "fl-vxlan"},
+		"fl-vxlan":         {"Common", "fl-vxlan"},
+	} {
+		p, n := splitFullPath(path)
+		if p != expected[0] || n != expected[1] {
+			t.Errorf("%s: expected %v, got %s %s", path, expected, p, n)
+		}
+	}
+}
+
+func Test_bgpCommands(t *testing.T) {
+	cmds := bgpCommands(64512, 64513, "k8s", []string{"10.0.0.9"}, []string{"10.0.0.1", "10.0.0.2"})
+	expected := []string{
+		"configure terminal",
+		"router bgp 64512",
+		"neighbor k8s peer-group",
+		"no neighbor 10.0.0.9",
+		"neighbor 10.0.0.1 remote-as 64513",
+		"neighbor 10.0.0.1 peer-group k8s",
+		"neighbor 10.0.0.2 remote-as 64513",
+		"neighbor 10.0.0.2 peer-group k8s",
+		"end",
+		"write",
+	}
+	if !reflect.DeepEqual(cmds, expected) {
+		t.Errorf("expected %v, got %v", expected, cmds)
+	}
+}
+
+func Test_parseGroupedNeighbors(t *testing.T) {
+	config := "!\nrouter bgp 64512\n neighbor k8s peer-group\n neighbor 10.0.0.1 remote-as 64512\n" +
+		" neighbor 10.0.0.1 peer-group k8s\n neighbor 10.0.0.8 remote-as 64512\n" +
+		" neighbor 10.0.0.9 peer-group others\n!\n"
+	expected := map[string]bool{"10.0.0.1": true}
+	if rlt := parseGroupedNeighbors(config, "k8s"); !reflect.DeepEqual(rlt, expected) {
+		t.Errorf("expected %v, got %v", expected, rlt)
+	}
+}
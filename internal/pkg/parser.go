@@ -1,7 +1,10 @@
 package pkg
 
 import (
+	"context"
+	"errors"
 	"fmt"
+	"net"
 	"reflect"
 	"strings"
 
@@ -44,39 +47,76 @@ import (
 // }
 
 func ParseAllForClass(className string) (map[string]interface{}, error) {
+	rlt, _, err := parseAllForClass(className)
+	return rlt, err
+}
+
+// parseAllForClass returns in addition the errors of the Gateways and HTTPRoutes skipped or parsed partially.
+func parseAllForClass(className string) (map[string]interface{}, []error, error) {
 	defer utils.TimeItToPrometheus()()
 
 	var gwc *gatewayapi.GatewayClass
 	if gwc = ActiveSIGs.GetGatewayClass(className); gwc == nil ||
 		gwc.Spec.ControllerName != gatewayapi.GatewayController(ActiveSIGs.ControllerName) {
-		return map[string]interface{}{}, nil
+		return map[string]interface{}{}, nil, nil
 	}
 
 	cgwObjs := ActiveSIGs.AttachedGateways(gwc)
 	folder := "serviceMain"
 
 	rlt := map[string]interface{}{}
+	errs := []error{}
 	for _, gw := range cgwObjs {
-		if err := parseGateway(gw, rlt); err != nil {
-			return map[string]interface{}{}, err
-		}
-		hrs := ActiveSIGs.AttachedHTTPRoutes(gw)
-		for _, hr := range hrs {
-			if err := parseHTTPRoute(className, hr, rlt); err != nil {
-				return map[string]interface{}{}, err
+		// parse each gateway and its routes separately, so that
+		// an invalid one is skipped without blocking the others.
+		grlt, hrerrs, err := parseGatewayWithRoutes(className, gw)
+		for hr, e := range hrerrs {
+			reportHTTPRouteStatus(hr, e)
+			if e != nil {
+				errs = append(errs, fmt.Errorf("HTTPRoute %s/%s: %s", hr.Namespace, hr.Name, e.Error()))
 			}
 		}
+		reportGatewayStatus(gw, err)
+		if err != nil {
+			errs = append(errs, fmt.Errorf("Gateway %s/%s: %s", gw.Namespace, gw.Name, err.Error()))
+		}
+		var pe *partialError
+		if err != nil && !errors.As(err, &pe) {
+			continue
+		}
+		for k, v := range grlt {
+			rlt[k] = v
+		}
 	}
 	if len(rlt) == 0 {
-		return nil, nil
+		return nil, errs, nil
 	} else {
 		return map[string]interface{}{
 			folder: rlt,
-		}, nil
+		}, errs, nil
 	}
 
 }
 
+// parseGatewayWithRoutes parses the gateway and its attached routes, the invalid routes are
+// skipped, the results of parsing each route are returned for status reporting.
+func parseGatewayWithRoutes(className string, gw *gatewayapi.Gateway) (map[string]interface{}, map[*gatewayapi.HTTPRoute]error, error) {
+	grlt := map[string]interface{}{}
+	hrerrs := map[*gatewayapi.HTTPRoute]error{}
+	for _, hr := range ActiveSIGs.AttachedHTTPRoutes(gw) {
+		hrlt := map[string]interface{}{}
+		err := parseHTTPRoute(className, hr, hrlt)
+		hrerrs[hr] = err
+		if err != nil {
+			continue
+		}
+		for k, v := range hrlt {
+			grlt[k] = v
+		}
+	}
+	return grlt, hrerrs, parseGateway(gw, grlt)
+}
+
 // ParseRelatedServices parse all refered services
 func ParseClassRelatedServices(gwc []string) (map[string]interface{}, error) {
 
@@ -99,8 +139,8 @@ func ParseServices(svcs []string) (map[string]interface{}, error) {
 		ns := strings.Split(svc, "/")[0]
 		n := strings.Split(svc, "/")[1]
 
-		if _, f := rlts[ns]; !f {
-			rlts[ns] = map[string]interface{}{
+		if _, f := rlts[tenantName(ns)]; !f {
+			rlts[tenantName(ns)] = map[string]interface{}{
 				"serviceMain": map[string]interface{}{},
 			}
 		}
@@ -111,7 +151,13 @@ func ParseServices(svcs []string) (map[string]interface{}, error) {
 			"members":  []interface{}{},
 		}
 		if fmtmbs, err := parseMembersFrom(ns, n); err != nil {
-			return nil, err
+			var me *memberModeError
+			if !errors.As(err, &me) {
+				return nil, err
+			}
+			// only the service with invalid member mode is skipped, the others are still deployed.
+			utils.LogFromContext(context.TODO()).Warnf("skipped service %s: %s", svc, err.Error())
+			continue
 		} else {
 			pool["members"] = fmtmbs
 		}
@@ -122,13 +168,10 @@ func ParseServices(svcs []string) (map[string]interface{}, error) {
 			pool["monitors"] = mon
 		}
 
-		// if err := parseArpsFrom(ns, n, rlt); err != nil {
-		// 	return rlt, err
-		// }
 		// if err := parseNodesFrom(ns, n, rlt); err != nil {
 		// 	return rlt, err
 		// }
-		rlts[ns].(map[string]interface{})["serviceMain"].(map[string]interface{})["ltm/pool/"+n] = pool
+		rlts[tenantName(ns)].(map[string]interface{})["serviceMain"].(map[string]interface{})["ltm/pool/"+n] = pool
 	}
 
 	return rlts, nil
@@ -156,16 +199,24 @@ func parseGateway(gw *gatewayapi.Gateway, rlt map[string]interface{}) error {
 	}
 	irules := map[string][]string{}
 	listeners := map[string]*gatewayapi.Listener{}
+	invalids := []string{}
 
-	// listener mapping
+	// listener mapping: only HTTP and HTTPS listeners are supported
 	for i, listener := range gw.Spec.Listeners {
-		vsname := gwListenerName(gw, &listener)
-		listeners[vsname] = &gw.Spec.Listeners[i]
+		switch listener.Protocol {
+		case gatewayapi.HTTPProtocolType, gatewayapi.HTTPSProtocolType:
+			vsname := gwListenerName(gw, &listener)
+			listeners[vsname] = &gw.Spec.Listeners[i]
+		default:
+			invalids = append(invalids, fmt.Sprintf("listener %s: unsupported ProtocolType: %s", listener.Name, listener.Protocol))
+		}
+	}
+	if len(listeners) == 0 && len(invalids) > 0 {
+		return fmt.Errorf("no valid listener: %s", strings.Join(invalids, "; "))
 	}
 
 	// irules mapping: when listener.Hostname is not nil
-	for _, listener := range gw.Spec.Listeners {
-		vsname := gwListenerName(gw, &listener)
+	for vsname, listener := range listeners {
 		if listener.Hostname != nil {
 			if _, ok := irules[vsname]; !ok {
 				irules[vsname] = []string{}
@@ -185,24 +236,24 @@ func parseGateway(gw *gatewayapi.Gateway, rlt map[string]interface{}) error {
 		}
 	}
 
-	// irules mapping: for httproutes
+	// irules mapping: for httproutes, skip the ones failed to parse
 	hrs := ActiveSIGs.AttachedHTTPRoutes(gw)
 	for _, hr := range hrs {
+		if _, f := rlt["ltm/rule/"+hrName(hr)]; !f {
+			continue
+		}
+		routetype := reflect.TypeOf(*hr).Name()
 		for _, pr := range hr.Spec.ParentRefs {
-			ns := hr.Namespace
-			if pr.Namespace != nil {
-				ns = string(*pr.Namespace)
-			}
-			if pr.SectionName == nil {
-				return fmt.Errorf("sectionName of paraentRefs is nil, not supported")
-			}
-			vsname := hrParentName(hr, &pr)
-			if _, ok := irules[vsname]; !ok {
-				irules[vsname] = []string{}
-			}
-			routetype := reflect.TypeOf(*hr).Name()
-			if RouteMatches(ns, listeners[vsname], ActiveSIGs.GetNamespace(hr.Namespace), routetype) {
-				irules[vsname] = append(irules[vsname], hrName(hr))
+			// without sectionName, the route attaches to all the listeners allowing it.
+			for _, ls := range parentListeners(gw, hr, &pr) {
+				vsname := gwListenerName(gw, ls)
+				if _, ok := irules[vsname]; !ok {
+					irules[vsname] = []string{}
+				}
+				if RouteMatches(gw.Namespace, listeners[vsname], ActiveSIGs.GetNamespace(hr.Namespace), routetype) &&
+					!utils.Contains(irules[vsname], hrName(hr)) {
+					irules[vsname] = append(irules[vsname], hrName(hr))
+				}
 			}
 		}
 	}
@@ -222,10 +273,16 @@ func parseGateway(gw *gatewayapi.Gateway, rlt map[string]interface{}) error {
 	for i, addr := range gw.Spec.Addresses {
 		if *addr.Type == gatewayapi.IPAddressType {
 			ipaddr := addr.Value
+			if net.ParseIP(ipaddr) == nil {
+				return fmt.Errorf("invalid IPAddress: %s", ipaddr)
+			}
 			for _, listener := range gw.Spec.Listeners {
 				virtual := map[string]interface{}{}
 
 				lsname := gwListenerName(gw, &listener)
+				if _, f := listeners[lsname]; !f {
+					continue
+				}
 				vrname := fmt.Sprintf("%s.%d", gwListenerName(gw, &listener), i)
 				switch listener.Protocol {
 				case gatewayapi.HTTPProtocolType:
@@ -235,12 +292,6 @@ func parseGateway(gw *gatewayapi.Gateway, rlt map[string]interface{}) error {
 					virtual["class"] = "Service_HTTPS"
 					virtual["profileHTTP"] = "basic"
 					virtual["serverTLS"] = lsname
-				case gatewayapi.TCPProtocolType:
-					return fmt.Errorf("unsupported ProtocolType: %s", listener.Protocol)
-				case gatewayapi.UDPProtocolType:
-					return fmt.Errorf("unsupported ProtocolType: %s", listener.Protocol)
-				case gatewayapi.TLSProtocolType:
-					return fmt.Errorf("unsupported ProtocolType: %s", listener.Protocol)
 				}
 
 				virtual["virtualAddresses"] = []string{ipaddr}
@@ -254,6 +305,9 @@ func parseGateway(gw *gatewayapi.Gateway, rlt map[string]interface{}) error {
 		}
 	}
 
+	if len(invalids) > 0 {
+		return &partialError{msgs: invalids}
+	}
 	return nil
 }
 
@@ -262,11 +316,51 @@ func parseMonitorFrom(svcNamespace, svcName string) (interface{}, error) {
 	return []string{"tcp"}, nil
 }
 
+// memberModeError indicates that the member mode of the service cannot be decided.
+type memberModeError struct {
+	msg string
+}
+
+func (e *memberModeError) Error() string {
+	return e.msg
+}
+
+// memberModeOf returns the member mode of the service from the annotations of the gateway classes referring to it.
+func memberModeOf(svc *v1.Service) (string, error) {
+	modes := map[string][]string{}
+	for _, gw := range ActiveSIGs.GetRootGateways([]*v1.Service{svc}) {
+		gwc := ActiveSIGs.GetGatewayClass(string(gw.Spec.GatewayClassName))
+		if gwc == nil {
+			continue
+		}
+		mode := gwc.Annotations[Annotation_MemberMode]
+		if err := k8s.ValidMemberMode(mode); err != nil {
+			return "", &memberModeError{msg: fmt.Sprintf("invalid annotation %s of gatewayclass %s: %s", Annotation_MemberMode, gwc.Name, err.Error())}
+		}
+		modes[mode] = append(modes[mode], gwc.Name)
+	}
+
+	switch len(modes) {
+	case 0:
+		return k8s.MemberMode_Auto, nil
+	case 1:
+		for mode := range modes {
+			return mode, nil
+		}
+	}
+	return "", &memberModeError{msg: fmt.Sprintf("service %s is referred by gatewayclasses with different member modes: %v",
+		utils.Keyname(svc.Namespace, svc.Name), modes)}
+}
+
 func parseMembersFrom(svcNamespace, svcName string) ([]interface{}, error) {
 	svc := ActiveSIGs.GetService(utils.Keyname(svcNamespace, svcName))
 	eps := ActiveSIGs.GetEndpoints(utils.Keyname(svcNamespace, svcName))
 	if svc != nil && eps != nil {
-		if mbs, err := k8s.FormatMembersFromServiceEndpoints(svc, eps); err != nil {
+		mode, err := memberModeOf(svc)
+		if err != nil {
+			return []interface{}{}, err
+		}
+		if mbs, err := k8s.FormatMembersFromServiceEndpoints(svc, eps, mode); err != nil {
 			return []interface{}{}, err
 		} else {
 			fmtmbs := []interface{}{}
@@ -284,27 +378,93 @@ func parseMembersFrom(svcNamespace, svcName string) ([]interface{}, error) {
 	}
 }
 
-// func parseArpsFrom(svcNamespace, svcName string, rlt map[string]interface{}) error {
-// 	svc := ActiveSIGs.GetService(utils.Keyname(svcNamespace, svcName))
-// 	eps := ActiveSIGs.GetEndpoints(utils.Keyname(svcNamespace, svcName))
-// 	if svc != nil && eps != nil {
-// 		if mbs, err := k8s.FormatMembersFromServiceEndpoints(svc, eps); err != nil {
-// 			return err
-// 		} else {
-// 			prefix := "k8s-"
-// 			for _, mb := range mbs {
-// 				if mb.MacAddr != "" {
-// 					rlt["net/arp/"+prefix+mb.IpAddr] = map[string]interface{}{
-// 						"name":       prefix + mb.IpAddr,
-// 						"ipAddress":  mb.IpAddr,
-// 						"macAddress": mb.MacAddr,
-// 					}
-// 				}
-// 			}
-// 		}
-// 	}
-// 	return nil
-// }
+// parseArpsFrom parses static arps of the pod IP members with known VTEP MACs.
+func parseArpsFrom(svcNamespace, svcName string, rlt map[string]interface{}) error {
+	svc := ActiveSIGs.GetService(utils.Keyname(svcNamespace, svcName))
+	eps := ActiveSIGs.GetEndpoints(utils.Keyname(svcNamespace, svcName))
+	if svc != nil && eps != nil {
+		mode, err := memberModeOf(svc)
+		if err != nil {
+			return err
+		}
+		if mbs, err := k8s.FormatMembersFromServiceEndpoints(svc, eps, mode); err != nil {
+			return err
+		} else {
+			for _, mb := range mbs {
+				if mb.MacAddr != "" {
+					// IPv6 neighbors are resolved by ndp instead of arp.
+					t := "net/arp/"
+					if utils.IsIpv6(mb.IpAddr) {
+						t = "net/ndp/"
+					}
+					rlt[t+networkPrefix()+mb.IpAddr] = map[string]interface{}{
+						"name":       networkPrefix() + mb.IpAddr,
+						"ipAddress":  mb.IpAddr,
+						"macAddress": mb.MacAddr,
+					}
+				}
+			}
+		}
+	}
+	return nil
+}
+
+// parseFdbsFrom parses the tunnel fdb records of the nodes with VTEP MACs,
+// records of IPv6 tunnel endpoints are parsed as net/fdb-v6.
+func parseFdbsFrom(nodes map[string]k8s.K8Node, rlt map[string]interface{}) {
+	for _, nd := range nodes {
+		if nd.NetType != "vxlan" {
+			continue
+		}
+		if nd.MacAddr != "" && nd.IpAddr != "" {
+			rlt["net/fdb/"+nd.MacAddr] = map[string]interface{}{
+				"name":     nd.MacAddr,
+				"endpoint": nd.IpAddr,
+			}
+		}
+		if nd.MacAddrV6 != "" && nd.IpAddrV6 != "" {
+			rlt["net/fdb-v6/"+nd.MacAddrV6] = map[string]interface{}{
+				"name":     nd.MacAddrV6,
+				"endpoint": nd.IpAddrV6,
+			}
+		}
+	}
+}
+
+// parseRoutesFrom parses the static routes to pod CIDRs and bgp neighbors of the routed(calico) nodes.
+func parseRoutesFrom(nodes map[string]k8s.K8Node, rlt map[string]interface{}) {
+	for _, nd := range nodes {
+		if nd.NetType != "calico-underlay" {
+			continue
+		}
+		for _, ipaddr := range []string{nd.IpAddr, nd.IpAddrV6} {
+			if ipaddr != "" {
+				rlt["net/bgp-neighbor/"+ipaddr] = map[string]interface{}{
+					"address": ipaddr,
+				}
+			}
+		}
+		for i, cidr := range nd.PodCIDRs {
+			// the pod CIDRs are routed via the node address of the same family.
+			gw := nd.IpAddr
+			if strings.Contains(cidr, ":") {
+				gw = nd.IpAddrV6
+			}
+			if gw == "" {
+				continue
+			}
+			name := networkPrefix() + nd.Name
+			if i > 0 {
+				name = fmt.Sprintf("%s-%d", name, i)
+			}
+			rlt["net/route/"+name] = map[string]interface{}{
+				"name":    name,
+				"network": cidr,
+				"gw":      gw,
+			}
+		}
+	}
+}
 
 // func parseNodesFrom(svcNamespace, svcName string, rlt map[string]interface{}) error {
 // 	svc := ActiveSIGs.GetService(utils.Keyname(svcNamespace, svcName))
@@ -2,9 +2,15 @@ package pkg
 
 import (
 	"encoding/json"
+	"errors"
+	"reflect"
+	"sort"
 	"testing"
 
+	"github.com/f5devcentral/bigip-kubernetes-gateway/internal/k8s"
 	"gopkg.in/yaml.v3"
+	v1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
 	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
 	"k8s.io/apimachinery/pkg/runtime"
 
@@ -68,6 +74,120 @@ spec:
 	}
 }
 
+func Test_parseGateway(t *testing.T) {
+	gwyaml := `
+apiVersion: gateway.networking.k8s.io/v1
+kind: Gateway
+metadata:
+  name: mygateway
+  namespace: default
+spec:
+  gatewayClassName: bigip
+  listeners:
+    - name: http
+      port: 80
+      protocol: HTTP
+  addresses:
+    - type: IPAddress
+      value: 10.250.17.121
+    - type: IPAddress
+      value: 2001:db8::121
+`
+
+	var gw gatewayapi.Gateway
+	if err := load2runtimeObject([]byte(gwyaml), &gw); err != nil {
+		t.Fatalf("failed with msg: %s", err.Error())
+	}
+
+	rlt := map[string]interface{}{}
+	if err := parseGateway(&gw, rlt); err != nil {
+		t.Fatalf("failed with msg: %s", err.Error())
+	}
+	for name, addr := range map[string]string{
+		"ltm/virtual/gw.default.mygateway.http.0": "10.250.17.121",
+		"ltm/virtual/gw.default.mygateway.http.1": "2001:db8::121",
+	} {
+		virtual, ok := rlt[name].(map[string]interface{})
+		if !ok {
+			t.Fatalf("%s not found in %v", name, rlt)
+		}
+		if addrs := virtual["virtualAddresses"].([]string); len(addrs) != 1 || addrs[0] != addr {
+			t.Errorf("%s: expected address %s, got %v", name, addr, addrs)
+		}
+	}
+
+	gw.Spec.Addresses[1].Value = "2001:db8::xyz"
+	if err := parseGateway(&gw, map[string]interface{}{}); err == nil {
+		t.Errorf("expected error for invalid address")
+	}
+}
+
+func Test_parseGateway_partialListeners(t *testing.T) {
+	gwyaml := `
+apiVersion: gateway.networking.k8s.io/v1
+kind: Gateway
+metadata:
+  name: mygateway
+  namespace: default
+spec:
+  gatewayClassName: bigip
+  listeners:
+    - name: http
+      port: 80
+      protocol: HTTP
+    - name: tcp
+      port: 8080
+      protocol: TCP
+  addresses:
+    - type: IPAddress
+      value: 10.250.17.121
+`
+
+	var gw gatewayapi.Gateway
+	if err := load2runtimeObject([]byte(gwyaml), &gw); err != nil {
+		t.Fatalf("failed with msg: %s", err.Error())
+	}
+
+	rlt := map[string]interface{}{}
+	err := parseGateway(&gw, rlt)
+	var pe *partialError
+	if !errors.As(err, &pe) {
+		t.Fatalf("expected partial error, got %v", err)
+	}
+	if _, f := rlt["ltm/virtual/gw.default.mygateway.http.0"]; !f {
+		t.Errorf("valid listener http should be rendered: %v", rlt)
+	}
+	if _, f := rlt["ltm/virtual/gw.default.mygateway.tcp.0"]; f {
+		t.Errorf("invalid listener tcp should be skipped: %v", rlt)
+	}
+
+	reportGatewayStatus(&gw, err)
+	s := StatusUpdates.Get().(ObjectStatus)
+	if !s.Status || s.Reason != string(gatewayapi.GatewayReasonListenersNotValid) {
+		t.Errorf("unexpected status: %v", s)
+	}
+	reportGatewayStatus(&gw, err)
+	if StatusUpdates.Len() != 0 {
+		t.Errorf("unchanged status should not be queued again")
+	}
+	gw.Generation++
+	reportGatewayStatus(&gw, err)
+	if StatusUpdates.Len() != 1 || StatusUpdates.Get().(ObjectStatus).Generation != gw.Generation {
+		t.Errorf("status of a new generation should be queued")
+	}
+
+	gw.Spec.Listeners = gw.Spec.Listeners[1:]
+	err = parseGateway(&gw, map[string]interface{}{})
+	if err == nil || errors.As(err, &pe) {
+		t.Fatalf("expected error for no valid listener, got %v", err)
+	}
+	reportGatewayStatus(&gw, err)
+	s = StatusUpdates.Get().(ObjectStatus)
+	if s.Status || s.Reason != string(gatewayapi.GatewayReasonInvalid) {
+		t.Errorf("unexpected status: %v", s)
+	}
+}
+
 func yaml2json(data []byte) ([]byte, error) {
 	var intf interface{}
 	if err := yaml.Unmarshal(data, &intf); err != nil {
@@ -92,3 +212,85 @@ func load2runtimeObject(yamldata []byte, obj runtime.Object) error {
 	}
 	return nil
 }
+
+func Test_ParseServices_memberModeConflict(t *testing.T) {
+	saved := ActiveSIGs
+	defer func() { ActiveSIGs = saved }()
+	ActiveSIGs = benchmarkCache(20)
+
+	// svc0 is referred by gwc and gwc-np of different member modes, svc10 by gwc only.
+	sn := gatewayapi.SectionName("https")
+	ActiveSIGs.SetGatewayClass(&gatewayapi.GatewayClass{ObjectMeta: metav1.ObjectMeta{
+		Name:        "gwc-np",
+		Annotations: map[string]string{Annotation_MemberMode: k8s.MemberMode_NodePort},
+	}})
+	gw := ActiveSIGs.GetGateway("ns0/gw0").DeepCopy()
+	gw.Name, gw.Spec.GatewayClassName = "gw-np", "gwc-np"
+	ActiveSIGs.SetGateway(gw)
+	hr := ActiveSIGs.GetHTTPRoute("ns0/hr0").DeepCopy()
+	hr.Name, hr.Spec.ParentRefs = "hr-np", []gatewayapi.ParentReference{{Name: "gw-np", SectionName: &sn}}
+	ActiveSIGs.SetHTTPRoute(hr)
+	for _, n := range []string{"svc0", "svc10"} {
+		ActiveSIGs.GetService("ns0/" + n).Spec.Type = v1.ServiceTypeClusterIP
+		ActiveSIGs.SetEndpoints(&v1.Endpoints{ObjectMeta: metav1.ObjectMeta{Namespace: "ns0", Name: n}})
+	}
+
+	rlt, err := ParseServices([]string{"ns0/svc0", "ns0/svc10"})
+	if err != nil {
+		t.Fatalf("expected the conflicting service skipped only, got error: %s", err.Error())
+	}
+	pools := rlt[tenantName("ns0")].(map[string]interface{})["serviceMain"].(map[string]interface{})
+	if _, f := pools["ltm/pool/svc0"]; f {
+		t.Errorf("expected svc0 of conflicting member modes skipped: %v", pools)
+	}
+	if _, f := pools["ltm/pool/svc10"]; !f {
+		t.Errorf("expected svc10 still rendered: %v", pools)
+	}
+}
+
+func Test_parseGateway_noSectionName(t *testing.T) {
+	saved := ActiveSIGs
+	defer func() { ActiveSIGs = saved }()
+	ActiveSIGs = benchmarkCache(20)
+
+	// hr0 refers to gw0 without sectionName, while hr10 refers to its https listener.
+	from, addrType := gatewayapi.NamespacesFromSame, gatewayapi.IPAddressType
+	gw := ActiveSIGs.GetGateway("ns0/gw0").DeepCopy()
+	gw.Spec.Addresses = []gatewayapi.GatewayAddress{{Type: &addrType, Value: "10.250.17.121"}}
+	gw.Spec.Listeners = append(gw.Spec.Listeners, gatewayapi.Listener{
+		Name:          "http",
+		Port:          80,
+		Protocol:      gatewayapi.HTTPProtocolType,
+		AllowedRoutes: &gatewayapi.AllowedRoutes{Namespaces: &gatewayapi.RouteNamespaces{From: &from}},
+	})
+	ActiveSIGs.SetGateway(gw)
+	hr := ActiveSIGs.GetHTTPRoute("ns0/hr0").DeepCopy()
+	hr.Spec.ParentRefs = []gatewayapi.ParentReference{{Name: "gw0"}}
+	ActiveSIGs.SetHTTPRoute(hr)
+
+	if gws := ActiveSIGs.GatewayRefsOfHR(hr); len(gws) != 1 || gws[0].Name != "gw0" {
+		t.Errorf("expected hr0 refers to gw0, got %v", gws)
+	}
+	if hrs := ActiveSIGs.AttachedHTTPRoutes(gw); len(hrs) != 2 {
+		t.Errorf("expected hr0 and hr10 attached to gw0, got %d", len(hrs))
+	}
+
+	rlt, _, err := parseGatewayWithRoutes("gwc", gw)
+	if err != nil {
+		t.Fatalf("failed to parse gateway: %s", err.Error())
+	}
+	for vs, expected := range map[string][]string{
+		"ltm/virtual/gw.ns0.gw0.http.0":  {"hr.ns0.hr0"},
+		"ltm/virtual/gw.ns0.gw0.https.0": {"hr.ns0.hr0", "hr.ns0.hr10"},
+	} {
+		virtual, f := rlt[vs].(map[string]interface{})
+		if !f {
+			t.Fatalf("expected %s rendered: %v", vs, rlt)
+		}
+		irules := virtual["iRules"].([]string)
+		sort.Strings(irules)
+		if !reflect.DeepEqual(irules, expected) {
+			t.Errorf("expected irules of %s %v, got %v", vs, expected, irules)
+		}
+	}
+}
@@ -0,0 +1,125 @@
+package pkg
+
+import (
+	"encoding/base64"
+	"regexp"
+	"strings"
+
+	v1 "k8s.io/api/core/v1"
+)
+
+const redactedValue = "<redacted>"
+
+// sensitiveFields are the properties of AS3 objects whose values are never logged, dumped or shown in diffs.
+var sensitiveFields = map[string]bool{
+	"privateKey": true,
+	"passphrase": true,
+	"ciphertext": true,
+	"password":   true,
+}
+
+var (
+	// pemPrivateKeys matches PEM private key blocks, including the truncated ones and the ones
+	// with escaped newlines in JSON text.
+	pemPrivateKeys = regexp.MustCompile(`(?s)-----BEGIN [A-Z0-9 ]*PRIVATE KEY-----.*?(-----END [A-Z0-9 ]*PRIVATE KEY-----|"|$)`)
+	// base64PEMs matches the base64 encoded PEM blocks, i.e. Secret data, "LS0tLS1CRUdJTi" is "-----BEGIN".
+	base64PEMs = regexp.MustCompile(`LS0tLS1CRUdJTi[A-Za-z0-9+/=]*`)
+	// sensitiveJsonFields matches the string values of sensitiveFields in JSON text.
+	sensitiveJsonFields = regexp.MustCompile(`"(privateKey|passphrase|ciphertext|password)"\s*:\s*"(?:[^"\\]|\\.)*"`)
+)
+
+// RedactText removes private keys and the values of sensitive fields from the text, e.g.
+// error messages echoing the declaration.
+func RedactText(s string) string {
+	s = sensitiveJsonFields.ReplaceAllString(s, `"$1": "`+redactedValue+`"`)
+	s = pemPrivateKeys.ReplaceAllStringFunc(s, func(m string) string {
+		if strings.HasSuffix(m, `"`) {
+			return redactedValue + `"`
+		}
+		return redactedValue
+	})
+	s = base64PEMs.ReplaceAllStringFunc(s, func(m string) string {
+		d, err := base64.StdEncoding.DecodeString(m)
+		if err != nil {
+			// may be truncated, redacted anyway
+			d, _ = base64.StdEncoding.DecodeString(m[:len(m)/4*4])
+		}
+		if strings.Contains(string(d), "PRIVATE KEY") || err != nil {
+			return redactedValue
+		}
+		return m
+	})
+	return s
+}
+
+// redactDeclaration returns a copy of the declaration or parsed resources, with the
+// values of the sensitive fields, e.g. private keys, replaced.
+func redactDeclaration(v interface{}) interface{} {
+	switch tv := v.(type) {
+	case map[string]interface{}:
+		rlt := map[string]interface{}{}
+		for k, sv := range tv {
+			if sensitiveFields[k] {
+				rlt[k] = redactedValue
+			} else {
+				rlt[k] = redactDeclaration(sv)
+			}
+		}
+		return rlt
+	case []interface{}:
+		rlt := []interface{}{}
+		for _, sv := range tv {
+			rlt = append(rlt, redactDeclaration(sv))
+		}
+		return rlt
+	case string:
+		return RedactText(tv)
+	default:
+		return v
+	}
+}
+
+// RedactDeclaration is redactDeclaration for the declarations printed by the commands.
+func RedactDeclaration(decl map[string]interface{}) map[string]interface{} {
+	return redactDeclaration(decl).(map[string]interface{})
+}
+
+// redactSecret replaces the data of the generic secret object, including the copy in the
+// last-applied-configuration annotation.
+func redactSecret(scrt interface{}) {
+	s, ok := scrt.(map[string]interface{})
+	if !ok {
+		return
+	}
+	for _, field := range []string{"data", "stringData"} {
+		if data, ok := s[field].(map[string]interface{}); ok {
+			for k := range data {
+				data[k] = redactedValue
+			}
+		}
+	}
+	if meta, ok := s["metadata"].(map[string]interface{}); ok {
+		if annotations, ok := meta["annotations"].(map[string]interface{}); ok {
+			if _, f := annotations[v1.LastAppliedConfigAnnotation]; f {
+				annotations[v1.LastAppliedConfigAnnotation] = redactedValue
+			}
+		}
+	}
+}
+
+// isSensitive tells if the path of a field, in format of a.b[0].c, is or is under a sensitive field.
+func isSensitive(path string) bool {
+	for _, seg := range strings.FieldsFunc(path, func(r rune) bool { return r == '.' || r == '[' }) {
+		if sensitiveFields[seg] {
+			return true
+		}
+	}
+	return false
+}
+
+func redacted(v interface{}) interface{} {
+	if v == nil {
+		return nil
+	}
+	return redactedValue
+}
@@ -0,0 +1,130 @@
+package pkg
+
+import (
+	"context"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/json"
+	"encoding/pem"
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	v1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+func testPrivateKey(t *testing.T) string {
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	der, err := x509.MarshalPKCS8PrivateKey(key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return string(pem.EncodeToMemory(&pem.Block{Type: "PRIVATE KEY", Bytes: der}))
+}
+
+// assertNoKeyMaterial fails if any line of the PEM body, raw or base64 encoded, appears in text.
+func assertNoKeyMaterial(t *testing.T, what, text, keyPEM string) {
+	t.Helper()
+	encoded := base64.StdEncoding.EncodeToString([]byte(keyPEM))
+	for _, l := range append(strings.Split(strings.TrimSpace(keyPEM), "\n"), encoded[:40]) {
+		if strings.HasPrefix(l, "-----END") {
+			continue
+		}
+		if strings.Contains(text, l) {
+			t.Errorf("%s leaks key material '%s': %s", what, l, text)
+			return
+		}
+	}
+}
+
+func Test_RedactText(t *testing.T) {
+	keyPEM := testPrivateKey(t)
+	escaped, _ := json.Marshal(keyPEM)
+	cases := map[string]string{
+		"raw":          "failed: " + keyPEM,
+		"json escaped": fmt.Sprintf(`{"cert": {"class": "Certificate", "privateKey": %s}}`, escaped),
+		"truncated":    "failed: " + keyPEM[:len(keyPEM)/2],
+		"base64":       "data: " + base64.StdEncoding.EncodeToString([]byte(keyPEM)),
+		"password":     `{"password": "p@ss\"word"}`,
+	}
+	for name, text := range cases {
+		got := RedactText(text)
+		assertNoKeyMaterial(t, name, got, keyPEM)
+		if strings.Contains(got, "p@ss") {
+			t.Errorf("%s leaks password: %s", name, got)
+		}
+	}
+	if got := RedactText("certificate: -----BEGIN CERTIFICATE-----"); got != "certificate: -----BEGIN CERTIFICATE-----" {
+		t.Errorf("certificates should be kept, got %s", got)
+	}
+}
+
+func Test_redaction_noKeyLeaks(t *testing.T) {
+	keyPEM := testPrivateKey(t)
+	scrt := &v1.Secret{
+		ObjectMeta: metav1.ObjectMeta{
+			Namespace:   "default",
+			Name:        "tls",
+			Annotations: map[string]string{v1.LastAppliedConfigAnnotation: base64.StdEncoding.EncodeToString([]byte(keyPEM))},
+		},
+		Type: v1.SecretTypeTLS,
+		Data: map[string][]byte{
+			v1.TLSCertKey:       []byte("-----BEGIN CERTIFICATE-----"),
+			v1.TLSPrivateKeyKey: []byte(keyPEM),
+		},
+	}
+
+	// debug dumps of the cache
+	ActiveSIGs.SetSecret(scrt)
+	defer ActiveSIGs.UnsetSerect("default/tls")
+	dump, err := ActiveSIGs.Dump()
+	if err != nil {
+		t.Fatal(err)
+	}
+	b, _ := json.Marshal(dump)
+	assertNoKeyMaterial(t, "cache dump", string(b), keyPEM)
+
+	// declarations in debug logs, dry-run outputs and queue dumps
+	rlt := map[string]interface{}{}
+	parseSecrets("gw.default.gw.https", []*v1.Secret{scrt}, rlt)
+	as3 := RestToAS3(map[string]interface{}{"bigip": map[string]interface{}{"serviceMain": rlt}})
+	b, _ = json.Marshal(redactDeclaration(as3))
+	assertNoKeyMaterial(t, "declaration", string(b), keyPEM)
+	if !strings.Contains(string(b), "BEGIN CERTIFICATE") {
+		t.Errorf("expected certificate kept in declaration: %s", string(b))
+	}
+
+	// diffs of declarations
+	diffs := DiffDeclarations(map[string]interface{}{}, as3)
+	current := RestToAS3(map[string]interface{}{"bigip": map[string]interface{}{"serviceMain": map[string]interface{}{
+		"sys/file/certificate/scrt.default.tls": map[string]interface{}{"class": "Certificate", "privateKey": "old"},
+	}}})
+	diffs = append(diffs, DiffDeclarations(current, as3)...)
+	b, _ = json.Marshal(diffs)
+	assertNoKeyMaterial(t, "diffs", string(b)+FormatDiffs(diffs), keyPEM)
+
+	// error messages of the AS3 echoing the declaration
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, _ := io.ReadAll(r.Body)
+		w.WriteHeader(http.StatusUnprocessableEntity)
+		w.Write(body)
+	}))
+	defer ts.Close()
+	ac := newAS3Client(ts.URL, "")
+	for tn, err := range ac.deploy(context.TODO(), as3, []string{"bigip"}) {
+		if err == nil {
+			t.Fatalf("expected error of tenant %s", tn)
+		}
+		assertNoKeyMaterial(t, "deploy error", err.Error(), keyPEM)
+	}
+}
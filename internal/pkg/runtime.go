@@ -0,0 +1,207 @@
+package pkg
+
+import (
+	"encoding/json"
+	"fmt"
+	"strings"
+
+	"github.com/f5devcentral/f5-bigip-rest-go/deployer"
+	"github.com/f5devcentral/f5-bigip-rest-go/utils"
+	v1 "k8s.io/api/core/v1"
+	gatewayapi "sigs.k8s.io/gateway-api/apis/v1"
+)
+
+const (
+	Trail_GatewayClass = "gatewayclass"
+	Trail_Gateway      = "gateway"
+	Trail_HTTPRoute    = "httproute"
+)
+
+// Dump returns a copy of the cached resources for debugging, with the data of the secrets redacted.
+func (c *SIGCache) Dump() (map[string]interface{}, error) {
+	c.mutex.RLock()
+	b, err := json.Marshal(c)
+	c.mutex.RUnlock()
+	if err != nil {
+		return nil, err
+	}
+
+	rlt := map[string]interface{}{}
+	if err := json.Unmarshal(b, &rlt); err != nil {
+		return nil, err
+	}
+	if scrts, ok := rlt["Secret"].(map[string]interface{}); ok {
+		for _, scrt := range scrts {
+			redactSecret(scrt)
+		}
+	}
+	return rlt, nil
+}
+
+// Trail returns what the resource of the kind and keyname is rendered to, and the related
+// resources, valid kinds are Trail_*. The keyname of gatewayclass is <name>, the others are <namespace>/<name>.
+func Trail(kind, keyname string) (map[string]interface{}, error) {
+	switch kind {
+	case Trail_GatewayClass:
+		return trailGatewayClass(keyname)
+	case Trail_Gateway:
+		return trailGateway(keyname)
+	case Trail_HTTPRoute:
+		return trailHTTPRoute(keyname)
+	default:
+		return nil, fmt.Errorf("unsupported trail kind %s, valid values: %s", kind,
+			strings.Join([]string{Trail_GatewayClass, Trail_Gateway, Trail_HTTPRoute}, ", "))
+	}
+}
+
+func trailGatewayClass(name string) (map[string]interface{}, error) {
+	gwc := ActiveSIGs.GetGatewayClass(name)
+	if gwc == nil {
+		return nil, fmt.Errorf("gatewayclass %s not found", name)
+	}
+	gateways := map[string]interface{}{}
+	for _, gw := range ActiveSIGs.AttachedGateways(gwc) {
+		t, err := trailGateway(utils.Keyname(gw.Namespace, gw.Name))
+		if err != nil {
+			return nil, err
+		}
+		gateways[utils.Keyname(gw.Namespace, gw.Name)] = t
+	}
+	return map[string]interface{}{
+		"tenant":         tenantName(name),
+		"controllerName": gwc.Spec.ControllerName,
+		"managed":        gwc.Spec.ControllerName == gatewayapi.GatewayController(ActiveSIGs.ControllerName),
+		"gateways":       gateways,
+	}, nil
+}
+
+func trailGateway(keyname string) (map[string]interface{}, error) {
+	gw := ActiveSIGs.GetGateway(keyname)
+	if gw == nil {
+		return nil, fmt.Errorf("gateway %s not found", keyname)
+	}
+	className := string(gw.Spec.GatewayClassName)
+
+	resources, hrerrs, err := parseGatewayWithRoutes(className, gw)
+	routes := map[string]interface{}{}
+	svcs := []*v1.Service{}
+	for hr, e := range hrerrs {
+		routes[utils.Keyname(hr.Namespace, hr.Name)] = errorString(e)
+		svcs = append(svcs, ActiveSIGs.AttachedServices(hr)...)
+	}
+	pools, perr := parseServiceObjects(svcs)
+	return map[string]interface{}{
+		"gatewayclass": className,
+		"tenant":       tenantName(className),
+		"error":        errorString(err),
+		"httproutes":   routes,
+		"resources":    redactDeclaration(resources),
+		"services":     serviceKeys(svcs),
+		"pools":        pools,
+		"poolsError":   errorString(perr),
+	}, nil
+}
+
+func trailHTTPRoute(keyname string) (map[string]interface{}, error) {
+	hr := ActiveSIGs.GetHTTPRoute(keyname)
+	if hr == nil {
+		return nil, fmt.Errorf("httproute %s not found", keyname)
+	}
+
+	gateways := []string{}
+	resources := map[string]interface{}{}
+	errs := map[string]interface{}{}
+	for _, gw := range ActiveSIGs.GatewayRefsOfHR(hr) {
+		className := string(gw.Spec.GatewayClassName)
+		gateways = append(gateways, utils.Keyname(gw.Namespace, gw.Name))
+		if _, f := resources[tenantName(className)]; f {
+			continue
+		}
+		rlt := map[string]interface{}{}
+		err := parseHTTPRoute(className, hr, rlt)
+		resources[tenantName(className)] = redactDeclaration(rlt)
+		errs[tenantName(className)] = errorString(err)
+	}
+	svcs := ActiveSIGs.AttachedServices(hr)
+	pools, perr := parseServiceObjects(svcs)
+	return map[string]interface{}{
+		"gateways":   gateways,
+		"resources":  resources,
+		"errors":     errs,
+		"services":   serviceKeys(svcs),
+		"pools":      pools,
+		"poolsError": errorString(perr),
+	}, nil
+}
+
+// Queues returns the pending requests and the states of the workers of each BIG-IP for debugging,
+// with the sensitive values of the declarations redacted.
+func Queues() map[string]interface{} {
+	dumps := func(dq *utils.DeployQueue) []interface{} {
+		rlt := []interface{}{}
+		if dq == nil {
+			return rlt
+		}
+		for _, item := range dq.Dumps() {
+			r, ok := item.(deployer.DeployRequest)
+			if !ok {
+				continue
+			}
+			req := map[string]interface{}{"requestId": utils.RequestIdFromContext(r.Context)}
+			if r.To != nil {
+				req["to"] = redactDeclaration(*r.To)
+			}
+			rlt = append(rlt, req)
+		}
+		return rlt
+	}
+
+	ws := map[string]interface{}{}
+	for _, w := range workers() {
+		w.mutex.RLock()
+		failures := map[string]string{}
+		for k, v := range w.failures {
+			failures[k] = v
+		}
+		tenants := []string{}
+		for k := range w.desired {
+			tenants = append(tenants, k)
+		}
+		state := map[string]interface{}{
+			"desired":  tenants,
+			"applied":  len(w.applied),
+			"failures": failures,
+			"catchup":  w.catchup,
+			"retries":  w.retries,
+		}
+		w.mutex.RUnlock()
+		state["pending"] = dumps(w.queue)
+		ws[w.bigip.URL] = state
+	}
+	return map[string]interface{}{
+		"pending": dumps(PendingDeploys),
+		"workers": ws,
+	}
+}
+
+func parseServiceObjects(svcs []*v1.Service) (interface{}, error) {
+	if len(svcs) == 0 {
+		return map[string]interface{}{}, nil
+	}
+	return ParseServices(serviceKeys(svcs))
+}
+
+func serviceKeys(svcs []*v1.Service) []string {
+	keys := []string{}
+	for _, svc := range svcs {
+		keys = append(keys, utils.Keyname(svc.Namespace, svc.Name))
+	}
+	return utils.Unified(keys)
+}
+
+func errorString(err error) string {
+	if err == nil {
+		return ""
+	}
+	return err.Error()
+}
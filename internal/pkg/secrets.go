@@ -0,0 +1,138 @@
+package pkg
+
+import (
+	"context"
+	"reflect"
+	"strings"
+
+	"github.com/f5devcentral/f5-bigip-rest-go/utils"
+	v1 "k8s.io/api/core/v1"
+	k8serrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/fields"
+	"k8s.io/apimachinery/pkg/types"
+	"sigs.k8s.io/controller-runtime/pkg/cache"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+)
+
+// SecretCacheOptions restricts the manager's informer of Secrets to the kubernetes.io/tls ones,
+// with their data dropped: the informer is only for the events, the data of the referenced ones
+// are loaded on demand by SyncReferencedSecrets.
+func SecretCacheOptions() cache.ByObject {
+	return cache.ByObject{
+		Field:     fields.OneTermEqualSelector("type", string(v1.SecretTypeTLS)),
+		Transform: stripSecretData,
+	}
+}
+
+func stripSecretData(obj interface{}) (interface{}, error) {
+	if scrt, ok := obj.(*v1.Secret); ok {
+		scrt.Data, scrt.StringData = nil, nil
+		scrt.ManagedFields = nil
+	}
+	return obj, nil
+}
+
+// IsSecretReferenced tells if any gateway listener refers to the secret of keyname, ReferenceGrants not considered.
+func (c *SIGCache) IsSecretReferenced(keyname string) bool {
+	c.mutex.RLock()
+	defer c.mutex.RUnlock()
+
+	return c._referencedSecrets()[keyname]
+}
+
+// SyncReferencedSecrets caches the kubernetes.io/tls secrets referenced by the gateway listeners
+// which are not cached yet, and drops the ones no longer referenced.
+func (c *SIGCache) SyncReferencedSecrets(ctx context.Context, reader client.Reader) error {
+	defer utils.TimeItToPrometheus()()
+
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+
+	return c._syncReferencedSecrets(ctx, reader)
+}
+
+// LoadSecret reads the secret of keyname with reader and caches it if it is referenced by gateways,
+// the secret is uncached if it is not referenced, not kubernetes.io/tls or not found.
+func (c *SIGCache) LoadSecret(ctx context.Context, reader client.Reader, keyname string) (*v1.Secret, error) {
+	defer utils.TimeItToPrometheus()()
+
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+
+	if !c._referencedSecrets()[keyname] {
+		delete(c.Secret, keyname)
+		return nil, nil
+	}
+	scrt, err := readTLSSecret(ctx, reader, keyname)
+	if scrt == nil || err != nil {
+		delete(c.Secret, keyname)
+		return nil, err
+	}
+	c.Secret[keyname] = scrt
+	return scrt, nil
+}
+
+func (c *SIGCache) _syncReferencedSecrets(ctx context.Context, reader client.Reader) error {
+	slog := utils.LogFromContext(ctx)
+	refs := c._referencedSecrets()
+	for k := range c.Secret {
+		if !refs[k] {
+			slog.Debugf("uncache secret %s which is no longer referenced", k)
+			delete(c.Secret, k)
+		}
+	}
+	for k := range refs {
+		if _, f := c.Secret[k]; f {
+			continue
+		}
+		scrt, err := readTLSSecret(ctx, reader, k)
+		if err != nil {
+			return err
+		}
+		if scrt == nil {
+			// the deployment reports the missing one.
+			slog.Warnf("secret %s referenced by gateways not found or not kubernetes.io/tls", k)
+			continue
+		}
+		slog.Debugf("found secret %s", k)
+		c.Secret[k] = scrt
+	}
+	return nil
+}
+
+// _referencedSecrets returns the keynames of the secrets referenced by the listeners of all gateways.
+func (c *SIGCache) _referencedSecrets() map[string]bool {
+	refs := map[string]bool{}
+	if c.index == nil {
+		return refs
+	}
+	for k := range c.index.secretGateways.referring {
+		// the secrets out of the watched namespaces are unreadable, reported missing on deployment.
+		if ns, _, _ := strings.Cut(k, "/"); IsWatchedNamespace(ns) {
+			refs[k] = true
+		}
+	}
+	return refs
+}
+
+// readTLSSecret reads the secret of keyname, nil is returned if it is not found or not kubernetes.io/tls.
+func readTLSSecret(ctx context.Context, reader client.Reader, keyname string) (*v1.Secret, error) {
+	ns, n, _ := strings.Cut(keyname, "/")
+	var scrt v1.Secret
+	if err := reader.Get(ctx, types.NamespacedName{Namespace: ns, Name: n}, &scrt); err != nil {
+		if k8serrors.IsNotFound(err) {
+			return nil, nil
+		}
+		return nil, err
+	}
+	if scrt.Type != v1.SecretTypeTLS {
+		return nil, nil
+	}
+	// read secrets have no TypeMeta set, complement it for referenceGrant check.
+	scrt.TypeMeta = metav1.TypeMeta{
+		APIVersion: v1.SchemeGroupVersion.Version,
+		Kind:       reflect.TypeOf(scrt).Name(),
+	}
+	return &scrt, nil
+}
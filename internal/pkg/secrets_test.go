@@ -0,0 +1,100 @@
+package pkg
+
+import (
+	"context"
+	"sync"
+	"testing"
+
+	v1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"sigs.k8s.io/controller-runtime/pkg/client/fake"
+	gatewayapi "sigs.k8s.io/gateway-api/apis/v1"
+	gatewayv1beta1 "sigs.k8s.io/gateway-api/apis/v1beta1"
+)
+
+func Test_SyncReferencedSecrets(t *testing.T) {
+	secret := func(ns, n string, typ v1.SecretType) *v1.Secret {
+		return &v1.Secret{
+			ObjectMeta: metav1.ObjectMeta{Namespace: ns, Name: n},
+			Type:       typ,
+			Data:       map[string][]byte{"tls.crt": []byte("crt"), "tls.key": []byte("key")},
+		}
+	}
+	cli := fake.NewClientBuilder().WithObjects(
+		secret("default", "referred", v1.SecretTypeTLS),
+		secret("default", "opaque", v1.SecretTypeOpaque),
+		secret("default", "unreferred", v1.SecretTypeTLS),
+		secret("other", "cross-ns", v1.SecretTypeTLS),
+	).Build()
+
+	otherNs := gatewayapi.Namespace("other")
+	gw := &gatewayapi.Gateway{
+		ObjectMeta: metav1.ObjectMeta{Namespace: "default", Name: "gw"},
+		Spec: gatewayapi.GatewaySpec{
+			Listeners: []gatewayapi.Listener{
+				{
+					Name:     "https",
+					Protocol: gatewayapi.HTTPSProtocolType,
+					TLS: &gatewayapi.GatewayTLSConfig{
+						CertificateRefs: []gatewayapi.SecretObjectReference{
+							{Name: "referred"},
+							{Name: "opaque"},
+							{Name: "missing"},
+							{Name: "cross-ns", Namespace: &otherNs},
+						},
+					},
+				},
+				{Name: "http", Protocol: gatewayapi.HTTPProtocolType},
+			},
+		},
+	}
+	c := &SIGCache{
+		mutex:          sync.RWMutex{},
+		Gateway:        map[string]*gatewayapi.Gateway{},
+		Secret:         map[string]*v1.Secret{"default/stale": secret("default", "stale", v1.SecretTypeTLS)},
+		ReferenceGrant: map[string]*gatewayv1beta1.ReferenceGrant{},
+	}
+	c.SetGateway(gw)
+
+	if err := c.SyncReferencedSecrets(context.TODO(), cli); err != nil {
+		t.Fatalf("failed to sync secrets: %s", err.Error())
+	}
+	if len(c.Secret) != 2 || c.Secret["default/referred"] == nil || c.Secret["other/cross-ns"] == nil {
+		t.Fatalf("expected only the referenced tls secrets cached, got %v", c.Secret)
+	}
+	if scrt := c.Secret["default/referred"]; scrt.Kind != "Secret" || string(scrt.Data["tls.key"]) != "key" {
+		t.Fatalf("expected the secret cached with TypeMeta and data, got %v", scrt)
+	}
+
+	if scrt, err := c.LoadSecret(context.TODO(), cli, "default/unreferred"); err != nil || scrt != nil {
+		t.Fatalf("expected the unreferenced secret not loaded, got %v, %v", scrt, err)
+	}
+
+	gw.Spec.Listeners[0].TLS.CertificateRefs = append(gw.Spec.Listeners[0].TLS.CertificateRefs,
+		gatewayapi.SecretObjectReference{Name: "unreferred"})
+	c.SetGateway(gw)
+	if scrt, err := c.LoadSecret(context.TODO(), cli, "default/unreferred"); err != nil || scrt == nil {
+		t.Fatalf("expected the newly referenced secret loaded, got %v, %v", scrt, err)
+	}
+
+	gw.Spec.Listeners = gw.Spec.Listeners[1:]
+	c.SetGateway(gw)
+	if err := c.SyncReferencedSecrets(context.TODO(), cli); err != nil {
+		t.Fatalf("failed to sync secrets: %s", err.Error())
+	}
+	if len(c.Secret) != 0 {
+		t.Fatalf("expected the secrets no longer referenced uncached, got %v", c.Secret)
+	}
+}
+
+func Test_stripSecretData(t *testing.T) {
+	scrt := &v1.Secret{
+		ObjectMeta: metav1.ObjectMeta{Namespace: "default", Name: "tls"},
+		Type:       v1.SecretTypeTLS,
+		Data:       map[string][]byte{"tls.key": []byte("key")},
+	}
+	obj, err := stripSecretData(scrt)
+	if err != nil || obj.(*v1.Secret).Data != nil || obj.(*v1.Secret).Type != v1.SecretTypeTLS {
+		t.Fatalf("expected the data stripped only, got %v, %v", obj, err)
+	}
+}
@@ -0,0 +1,128 @@
+package pkg
+
+import (
+	"errors"
+	"strings"
+
+	"github.com/f5devcentral/f5-bigip-rest-go/utils"
+	gatewayapi "sigs.k8s.io/gateway-api/apis/v1"
+)
+
+// partialError indicates that the object is rendered partially, with the invalid parts skipped.
+type partialError struct {
+	msgs []string
+}
+
+func (e *partialError) Error() string {
+	return strings.Join(e.msgs, "; ")
+}
+
+// reportStatus queues the status to StatusUpdates if it differs from the last reported one.
+func reportStatus(s ObjectStatus) {
+	// the messages are written to the objects, readable to whoever can read the routes.
+	s.Message = RedactText(s.Message)
+
+	statusMutex.Lock()
+	defer statusMutex.Unlock()
+
+	key := utils.Keyname(s.Kind, s.Namespace, s.Name, s.Type)
+	if o, f := statusCache[key]; f && o == s {
+		return
+	}
+	statusCache[key] = s
+	StatusUpdates.Add(s)
+}
+
+// ForgetStatus removes the last reported conditions of the deleted object.
+func ForgetStatus(kind, namespace, name string) {
+	statusMutex.Lock()
+	defer statusMutex.Unlock()
+
+	prefix := utils.Keyname(kind, namespace, name) + "/"
+	for k := range statusCache {
+		if strings.HasPrefix(k, prefix) {
+			delete(statusCache, k)
+		}
+	}
+}
+
+func reportGatewayStatus(gw *gatewayapi.Gateway, err error) {
+	s := ObjectStatus{
+		Kind:      "Gateway",
+		Namespace: gw.Namespace,
+		Name:      gw.Name,
+		Type:      string(gatewayapi.GatewayConditionAccepted),
+		Status:    true,
+		Reason:    string(gatewayapi.GatewayReasonAccepted),
+
+		Generation: gw.Generation,
+	}
+	var pe *partialError
+	if errors.As(err, &pe) {
+		s.Reason = string(gatewayapi.GatewayReasonListenersNotValid)
+		s.Message = err.Error()
+	} else if err != nil {
+		s.Status = false
+		s.Reason = string(gatewayapi.GatewayReasonInvalid)
+		s.Message = err.Error()
+	}
+	reportStatus(s)
+}
+
+func reportHTTPRouteStatus(hr *gatewayapi.HTTPRoute, err error) {
+	s := ObjectStatus{
+		Kind:      "HTTPRoute",
+		Namespace: hr.Namespace,
+		Name:      hr.Name,
+		Type:      string(gatewayapi.RouteConditionAccepted),
+		Status:    true,
+		Reason:    string(gatewayapi.RouteReasonAccepted),
+
+		Generation: hr.Generation,
+	}
+	if err != nil {
+		s.Status = false
+		s.Reason = string(gatewayapi.RouteReasonUnsupportedValue)
+		s.Message = err.Error()
+	}
+	reportStatus(s)
+}
+
+// reportProgrammedStatus reports the Programmed condition of the Gateways of the tenants (GatewayClasses),
+// which is False if the tenant fails to deploy to any BIG-IP with a permanent error.
+func reportProgrammedStatus(tenants []string) {
+	for _, tn := range tenants {
+		name, ok := tenantSource(tn)
+		if !ok {
+			continue
+		}
+		gwc := ActiveSIGs.GetGatewayClass(name)
+		if gwc == nil {
+			continue
+		}
+		msgs := []string{}
+		for _, w := range workers() {
+			if msg := w.failure(tn); msg != "" {
+				msgs = append(msgs, msg)
+			}
+		}
+		for _, gw := range ActiveSIGs.AttachedGateways(gwc) {
+			s := ObjectStatus{
+				Kind:      "Gateway",
+				Namespace: gw.Namespace,
+				Name:      gw.Name,
+				Type:      string(gatewayapi.GatewayConditionProgrammed),
+				Status:    true,
+				Reason:    string(gatewayapi.GatewayReasonProgrammed),
+
+				Generation: gw.Generation,
+			}
+			if len(msgs) > 0 {
+				s.Status = false
+				s.Reason = string(gatewayapi.GatewayReasonInvalid)
+				s.Message = strings.Join(msgs, "; ")
+			}
+			reportStatus(s)
+		}
+	}
+}
@@ -2,7 +2,10 @@ package pkg
 
 import (
 	"sync"
+	"time"
 
+	f5_bigip "github.com/f5devcentral/f5-bigip-rest-go/bigip"
+	"github.com/f5devcentral/f5-bigip-rest-go/utils"
 	v1 "k8s.io/api/core/v1"
 	gatewayapi "sigs.k8s.io/gateway-api/apis/v1"
 	gatewayv1beta1 "sigs.k8s.io/gateway-api/apis/v1beta1"
@@ -22,10 +25,58 @@ type SIGCache struct {
 	Namespace      map[string]*v1.Namespace
 	ReferenceGrant map[string]*gatewayv1beta1.ReferenceGrant
 	Secret         map[string]*v1.Secret
+
+	// index is the reverse references of Gateway and HTTPRoute, see sigIndexes.
+	index *sigIndexes
 }
 
 type ReferenceGrantFromTo map[string]map[string]int8
 
+// ObjectStatus is a condition of a Gateway or HTTPRoute, to be written to its status.
+type ObjectStatus struct {
+	Kind      string
+	Namespace string
+	Name      string
+	Type      string
+	Status    bool
+	Reason    string
+	Message   string
+	// Generation of the object parsed, so that a new generation is reported even if the condition doesn't change.
+	Generation int64
+}
+
+// bigipWorker deploys AS3 declarations to one BIG-IP with its own queue and states,
+// so that a slow or failed BIG-IP doesn't delay the others.
+type bigipWorker struct {
+	bigip *f5_bigip.BIGIP
+	as3   *as3Client
+	queue *utils.DeployQueue
+	// desired keeps the latest tenant declarations dispatched to the worker.
+	desired map[string]interface{}
+	// applied keeps the hashes of the tenant declarations deployed successfully.
+	applied map[string]string
+	// appliedDecls keeps the tenant declarations deployed successfully, as the base of member updates.
+	appliedDecls map[string]interface{}
+	// as3Applied keeps the hashes of the tenant declarations deployed via AS3, i.e. the ones stored by AS3,
+	// which differ from the applied ones once the pool members are updated over iControl REST.
+	as3Applied map[string]string
+	// heal are the drifted tenants to re-apply.
+	heal map[string]bool
+	// catchup is set when the last deployment failed, so that all desired tenants
+	// are deployed once the BIG-IP recovers.
+	catchup bool
+	// failures keeps the permanent errors of the tenants failed to deploy.
+	failures map[string]string
+	// retries counts the continuous transient failures for backoff.
+	retries    int
+	retryTimer *time.Timer
+	// syncTimer re-deploys the tenants via AS3 once their member updates over iControl REST stop.
+	syncTimer *time.Timer
+	// stopCh is closed when the worker stops, e.g. on losing the leadership.
+	stopCh chan struct{}
+	mutex  sync.RWMutex
+}
+
 type BIGIPConfigs []BIGIPConfig
 type BIGIPConfig struct {
 	Management struct {
@@ -33,4 +84,21 @@ type BIGIPConfig struct {
 		IpAddress string `yaml:"ipAddress"`
 		Port      *int
 	}
+	Network BIGIPNetworkConfig
+}
+
+type BIGIPNetworkConfig struct {
+	// VxlanTunnel is the full path of the BIG-IP VXLAN tunnel connected to the cluster overlay,
+	// e.g. /Common/fl-vxlan, its FDB records are managed by the controller.
+	VxlanTunnel string `yaml:"vxlanTunnel"`
+	// VxlanTunnelV6 is the VXLAN tunnel with IPv6 endpoints, e.g. the one for flannel IPv6 backend.
+	VxlanTunnelV6 string `yaml:"vxlanTunnelV6"`
+	// RouteMode decides how BIG-IP reaches the pod networks of routed(calico) nodes,
+	// valid values: "" (not managed), static, bgp.
+	RouteMode string `yaml:"routeMode"`
+	BGP       struct {
+		LocalAS     int `yaml:"localAS"`
+		RemoteAS    int `yaml:"remoteAS"`
+		RouteDomain int `yaml:"routeDomain"`
+	}
 }
@@ -2,16 +2,17 @@ package pkg
 
 import (
 	"context"
-	"encoding/json"
 	"fmt"
 	"reflect"
 	"strings"
 	"sync"
+	"time"
 
 	f5_bigip "github.com/f5devcentral/f5-bigip-rest-go/bigip"
 	"github.com/f5devcentral/f5-bigip-rest-go/deployer"
 	"github.com/f5devcentral/f5-bigip-rest-go/utils"
 	"github.com/google/uuid"
+	"github.com/prometheus/client_golang/prometheus"
 	v1 "k8s.io/api/core/v1"
 	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
 	"k8s.io/apimachinery/pkg/labels"
@@ -35,22 +36,51 @@ func init() {
 	}
 	refFromTo = &ReferenceGrantFromTo{}
 	LogLevel = utils.LogLevel_Type_INFO
+	netSyncCh = make(chan struct{}, 1)
+	StatusUpdates = utils.NewDeployQueue()
+	DriftedResources = prometheus.NewGaugeVec(
+		prometheus.GaugeOpts{
+			Name: "bigip_drifted_resources",
+			Help: "count of the resources drifted from the desired state on BIG-IP",
+		},
+		[]string{"bigip", "tenant"},
+	)
+	statusCache = map[string]ObjectStatus{}
+	BackendBatches = prometheus.NewCounter(
+		prometheus.CounterOpts{
+			Name: "bigip_backend_batches_total",
+			Help: "count of the deployments of the coalesced Endpoints and Service events",
+		},
+	)
+	BackendSavedDeploys = prometheus.NewCounter(
+		prometheus.CounterOpts{
+			Name: "bigip_backend_saved_deploys_total",
+			Help: "count of the deployments saved by coalescing Endpoints and Service events",
+		},
+	)
 }
 
 func hrName(hr *gatewayapi.HTTPRoute) string {
 	return strings.Join([]string{"hr", hr.Namespace, hr.Name}, ".")
 }
 
-func hrParentName(hr *gatewayapi.HTTPRoute, pr *gatewayapi.ParentReference) string {
+// parentListeners returns the listeners of the Gateway referred by the parentRef of the route,
+// i.e. the one named by sectionName, or all of them if sectionName is not set.
+func parentListeners(gw *gatewayapi.Gateway, hr *gatewayapi.HTTPRoute, pr *gatewayapi.ParentReference) []*gatewayapi.Listener {
 	ns := hr.Namespace
 	if pr.Namespace != nil {
 		ns = string(*pr.Namespace)
 	}
-	sn := ""
-	if pr.SectionName != nil {
-		sn = string(*pr.SectionName)
+	rlt := []*gatewayapi.Listener{}
+	if ns != gw.Namespace || string(pr.Name) != gw.Name {
+		return rlt
 	}
-	return strings.Join([]string{"gw", ns, string(pr.Name), sn}, ".")
+	for i, ls := range gw.Spec.Listeners {
+		if pr.SectionName == nil || *pr.SectionName == ls.Name {
+			rlt = append(rlt, &gw.Spec.Listeners[i])
+		}
+	}
+	return rlt
 }
 
 func gwListenerName(gw *gatewayapi.Gateway, ls *gatewayapi.Listener) string {
@@ -186,35 +216,55 @@ func DeployForEvent(ctx context.Context, impactedClasses []string) error {
 		return nil
 	}
 
-	ncfgs := map[string]interface{}{}
-	var err error
-
-	for _, n := range impactedClasses {
-		if ncfgs[n], err = ParseAllForClass(n); err != nil {
-			return err
-		}
-	}
-
-	if scfgs, err := ParseClassRelatedServices(impactedClasses); err != nil {
+	as3, err := RenderForClasses(impactedClasses)
+	if err != nil {
 		return err
-	} else {
-		for k, cfg := range scfgs {
-			ncfgs[k] = cfg
-		}
 	}
 
-	as3 := RestToAS3(ncfgs)
-
 	PendingDeploys.Add(deployer.DeployRequest{
 		From:    nil,
 		To:      &as3,
 		AS3:     true,
 		Context: ctx,
 	})
+	RequestNetSync()
 
 	return nil
 }
 
+// RenderForClasses parses the resources of the gateway classes from ActiveSIGs,
+// and returns the AS3 declaration of them and their related services.
+func RenderForClasses(classes []string) (map[string]interface{}, error) {
+	as3, _, err := RenderWithErrors(classes)
+	return as3, err
+}
+
+// RenderWithErrors is RenderForClasses returning in addition the errors of the Gateways and HTTPRoutes
+// skipped or rendered partially, which are reported to their status only by the controller.
+func RenderWithErrors(classes []string) (map[string]interface{}, []error, error) {
+	ncfgs := map[string]interface{}{}
+	errs := []error{}
+
+	for _, n := range classes {
+		cfg, perrs, err := parseAllForClass(n)
+		if err != nil {
+			return nil, nil, err
+		}
+		ncfgs[tenantName(n)] = cfg
+		errs = append(errs, perrs...)
+	}
+
+	if scfgs, err := ParseClassRelatedServices(classes); err != nil {
+		return nil, nil, err
+	} else {
+		for k, cfg := range scfgs {
+			ncfgs[k] = cfg
+		}
+	}
+
+	return RestToAS3(ncfgs), errs, nil
+}
+
 func (rgft *ReferenceGrantFromTo) set(rg *gatewayv1beta1.ReferenceGrant) {
 	ns := rg.Namespace
 	for _, f := range rg.Spec.From {
@@ -362,11 +412,14 @@ func RestToAS3(cfgs map[string]interface{}) map[string]interface{} {
 
 	for p, cfg := range cfgs {
 		tenant := map[string]interface{}{
-			"class": "Tenant",
+			"class":  "Tenant",
+			"label":  TenantLabel,
+			"remark": ownerRemark(),
 		}
 		for k, v := range cfg.(map[string]interface{}) {
 			application := map[string]interface{}{
-				"class": "Application",
+				"class":  "Application",
+				"remark": ownerRemark(),
 			}
 			for tn, resource := range v.(map[string]interface{}) {
 				t, n := typeAndName(tn)
@@ -386,6 +439,52 @@ func RestToAS3(cfgs map[string]interface{}) map[string]interface{} {
 	return as3
 }
 
+// tenantName returns the AS3 tenant name of the gateway class or namespace, with TenantPrefix
+// and ClusterName, so that clusters sharing the BIG-IP don't overwrite each other.
+func tenantName(name string) string {
+	if ClusterName == "" {
+		return TenantPrefix + name
+	}
+	return TenantPrefix + ClusterName + "_" + name
+}
+
+// tenantSource returns the gateway class or namespace name of the tenant, false if it's not generated by tenantName.
+func tenantSource(tenant string) (string, bool) {
+	prefix := tenantName("")
+	if !strings.HasPrefix(tenant, prefix) {
+		return "", false
+	}
+	return strings.TrimPrefix(tenant, prefix), true
+}
+
+// networkPrefix returns the name prefix of the static arps and routes of this cluster.
+func networkPrefix() string {
+	if ClusterName == "" {
+		return netPrefix
+	}
+	return netPrefix + ClusterName + "_"
+}
+
+// ownerRemark identifies the controller instance generating the tenants, in format of <cluster name>/<instance id>.
+func ownerRemark() string {
+	remark := utils.Keyname(ClusterName, InstanceID)
+	if len(remark) > 64 {
+		remark = remark[:64]
+	}
+	return remark
+}
+
+// ownedTenant tells if the tenant is generated by this controller instance. The tenants labeled
+// without remark are regarded as owned, which are generated by the earlier versions.
+func ownedTenant(t interface{}) bool {
+	tenant, ok := t.(map[string]interface{})
+	if !ok || tenant["label"] != TenantLabel {
+		return false
+	}
+	remark, _ := tenant["remark"].(string)
+	return remark == "" || remark == ownerRemark()
+}
+
 func typeAndName(s string) (string, string) {
 	a := strings.Split(s, "/")
 	l := len(a)
@@ -394,7 +493,18 @@ func typeAndName(s string) (string, string) {
 	return t, n
 }
 
+// HandleBackends deploys the pools of the services in the namespace, batched with the other
+// events of the namespace if the backend coalescer is set up, which retries the failed batches
+// with backoff itself, so nil is returned then.
 func HandleBackends(ctx context.Context, namespace string) error {
+	if coalescer != nil {
+		coalescer.add(namespace, time.Now())
+		return nil
+	}
+	return deployBackends(ctx, namespace)
+}
+
+func deployBackends(ctx context.Context, namespace string) error {
 	// slog := utils.LogFromContext(ctx)
 
 	svcs := ActiveSIGs.GetServicesWithNamespace(namespace)
@@ -410,7 +520,7 @@ func HandleBackends(ctx context.Context, namespace string) error {
 	cfgs := map[string]interface{}{}
 	var err error
 	if len(kn) == 0 {
-		cfgs[namespace] = map[string]interface{}{}
+		cfgs[tenantName(namespace)] = map[string]interface{}{}
 	} else {
 		cfgs, err = ParseServices(kn)
 		if err != nil {
@@ -425,106 +535,62 @@ func HandleBackends(ctx context.Context, namespace string) error {
 		AS3:     true,
 		Context: ctx,
 	})
+	RequestNetSync()
 
 	return nil
 }
 
-// AS3Deployer starts a goroutine for accepting DeployRequests and deploy them via AS3.
+// AS3Deployer starts a goroutine for accepting DeployRequests and dispatches them to
+// the workers of each BIG-IP, which deploy them via AS3 in parallel.
+// Once stopCh is closed, it returns after the workers finish their current deployments.
 func AS3Deployer(stopCh chan struct{}, bigips []*f5_bigip.BIGIP) {
-	tenantCache := map[string]interface{}{}
-	handleNext := func() {
-		// block getting from queue
-		r := PendingDeploys.Get().(deployer.DeployRequest)
-
-		as3body := *(r.To)
-		slog := utils.LogFromContext(r.Context)
-
-		// combine all requests from the queue
-		l := PendingDeploys.Len()
-		ids, ks := []string{}, []string{}
-		for i := 0; i < l; i++ {
-			m := PendingDeploys.Get().(deployer.DeployRequest)
-
-			tenants := (*m.To)["declaration"].(map[string]interface{})
-			for k, t := range tenants {
-				if reflect.TypeOf(t).Kind().String() == "map" {
-					// slog.Debugf("adding tenant: %s", k)
-					ks = append(ks, k)
+	wg := sync.WaitGroup{}
+	defer wg.Wait()
+
+	ws := []*bigipWorker{}
+	for _, bip := range bigips {
+		w := newBIGIPWorker(bip)
+		if appliedStore != nil {
+			ctx := NewContext()
+			if hashes, err := appliedStore.loadFor(ctx, bip.URL); err != nil {
+				utils.LogFromContext(ctx).Warnf("failed to load applied tenants of %s: %s", bip.URL, err.Error())
+			} else {
+				w.applied = hashes
+				for k, h := range hashes {
+					w.as3Applied[k] = h
 				}
-				as3body["declaration"].(map[string]interface{})[k] = t
 			}
-			ids = append(ids, utils.RequestIdFromContext(m.Context))
 		}
-		if len(ids) > 0 {
-			slog.Infof("merged requests %s: tenants: %s", ids, utils.Unified(ks))
+		ws = append(ws, w)
+		w.stopCh = stopCh
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			w.run()
+		}()
+	}
+	workersMutex.Lock()
+	deployWorkers = ws
+	workersMutex.Unlock()
+
+	wg.Add(1)
+	go func() {
+		defer wg.Done()
+		<-stopCh
+		wakeup(PendingDeploys)
+		for _, w := range ws {
+			wakeup(w.queue)
 		}
+	}()
 
-		// eliminate duplicate requests
-		for k, t := range as3body["declaration"].(map[string]interface{}) {
-			if reflect.TypeOf(t).Kind().String() != "map" {
-				continue
-			}
-			class, f := t.(map[string]interface{})["class"]
-			if !f || class != "Tenant" {
-				continue
-			}
-
-			if oldt, f := tenantCache[k]; f && utils.DeepEqual(oldt, t) {
-				delete(as3body["declaration"].(map[string]interface{}), k)
-			}
-		}
-
-		// check if there's necessary to do the as3 deployment.
-		found := false
-		for _, t := range as3body["declaration"].(map[string]interface{}) {
-			if reflect.TypeOf(t).Kind().String() != "map" {
-				continue
-			}
-			class, f := t.(map[string]interface{})["class"]
-			if !f || class != "Tenant" {
-				continue
-			}
-			found = true
-			break
+	handleNext := func() {
+		// block getting from queue
+		r := PendingDeploys.Get().(deployer.DeployRequest)
+		if isWakeup(r) {
+			return
 		}
-		// if yes
-		if found {
-			// debug the as3 body
-			r.To = &as3body
-			slog := utils.LogFromContext(r.Context)
-			b, _ := json.Marshal(as3body)
-			slog.Debugf("Deployed AS3: %s", string(b))
-
-			// do as3 deployment for every BIG-IP instance.
-			errs := []error{}
-			for _, bip := range bigips {
-				bc := &f5_bigip.BIGIPContext{Context: r.Context, BIGIP: *bip}
-				err := deployer.HandleRequest(bc, r)
-				DoneDeploys.Add(deployer.DeployResponse{
-					DeployRequest: r,
-					Status:        err,
-				})
-				errs = append(errs, err)
-			}
-
-			// if deployed successfully, update tenantCache to avoid duplicate request
-			for k, t := range as3body["declaration"].(map[string]interface{}) {
-				if reflect.TypeOf(t).Kind().String() != "map" {
-					continue
-				}
-				class, f := t.(map[string]interface{})["class"]
-				if !f || class != "Tenant" {
-					continue
-				}
-
-				if oldt, f := tenantCache[k]; !f || !utils.DeepEqual(oldt, t) {
-					if utils.MergeErrors(errs) == nil {
-						tenantCache[k] = t
-					} else {
-						delete(tenantCache, k)
-					}
-				}
-			}
+		for _, w := range ws {
+			w.queue.Add(r)
 		}
 	}
 
@@ -543,7 +609,7 @@ func RespHandler(stopCh chan struct{}) {
 		r := DoneDeploys.Get().(deployer.DeployResponse)
 		slog := utils.LogFromContext(r.Context)
 		if r.Status != nil {
-			slog.Errorf(r.Status.Error())
+			slog.Errorf("%s", RedactText(r.Status.Error()))
 		} else {
 			slog.Infof("done request handling.")
 		}
@@ -177,3 +177,30 @@ func Test_filterCommonResources(t *testing.T) {
 		})
 	}
 }
+
+func Test_tenantName_clusterScoped(t *testing.T) {
+	defer func(p, c string) { TenantPrefix, ClusterName = p, c }(TenantPrefix, ClusterName)
+
+	TenantPrefix, ClusterName = "", ""
+	if got := tenantName("default"); got != "default" {
+		t.Errorf("tenantName() = %s, want default", got)
+	}
+	if got := networkPrefix(); got != "k8s-" {
+		t.Errorf("networkPrefix() = %s, want k8s-", got)
+	}
+
+	TenantPrefix, ClusterName = "gw_", "east"
+	tenant := tenantName("default")
+	if tenant != "gw_east_default" {
+		t.Errorf("tenantName() = %s, want gw_east_default", tenant)
+	}
+	if src, ok := tenantSource(tenant); !ok || src != "default" {
+		t.Errorf("tenantSource() = %s, %v, want default, true", src, ok)
+	}
+	if _, ok := tenantSource("gw_west_default"); ok {
+		t.Errorf("tenantSource() accepts tenant of other cluster")
+	}
+	if got := networkPrefix(); got != "k8s-east_" {
+		t.Errorf("networkPrefix() = %s, want k8s-east_", got)
+	}
+}
@@ -1,8 +1,12 @@
 package pkg
 
 import (
+	"sync"
+	"time"
+
 	f5_bigip "github.com/f5devcentral/f5-bigip-rest-go/bigip"
 	"github.com/f5devcentral/f5-bigip-rest-go/utils"
+	"github.com/prometheus/client_golang/prometheus"
 )
 
 var (
@@ -14,9 +18,64 @@ var (
 	BIPPassword    string
 	refFromTo      *ReferenceGrantFromTo
 	LogLevel       string
+	netSyncCh      chan struct{}
+	StatusUpdates  *utils.DeployQueue
+	statusCache    map[string]ObjectStatus
+	statusMutex    sync.Mutex
+
+	deployWorkers []*bigipWorker
+	workersMutex  sync.RWMutex
+	appliedStore  *configMapStore
+	dryRun        *dryRunWriter
+
+	// watchNamespaces restricts the namespaced resources watched, nil for all.
+	watchNamespaces []string
+
+	DriftedResources *prometheus.GaugeVec
+
+	coalescer           *backendCoalescer
+	BackendBatches      prometheus.Counter
+	BackendSavedDeploys prometheus.Counter
+
+	// TenantPrefix is prepended to the names of the generated tenants.
+	TenantPrefix string
+	// ClusterName and InstanceID identify the owner of the generated tenants.
+	ClusterName string
+	InstanceID  string
+
+	// MemberFastPath turns on updating the pool members over iControl REST, instead of AS3,
+	// for the tenants changing in pool members only.
+	MemberFastPath bool
+	// as3SyncDelay is how long the member updates stop before the tenants are re-deployed via AS3,
+	// so that the declaration stored by AS3 catches up with the pool members on BIG-IP.
+	as3SyncDelay = time.Minute
+
+	// AS3TaskTimeout is the max time to wait for an async AS3 task.
+	AS3TaskTimeout  = 10 * time.Minute
+	as3PollInterval = time.Second
 )
 
 // const (
 // 	DeployMethod_AS3  = "as3"
 // 	DeployMethod_REST = "rest"
 // )
+
+const (
+	// Annotation_MemberMode is the GatewayClass annotation deciding the pool members of
+	// referred Services, valid values: cluster, nodeport, nodeportlocal, see k8s.MemberMode_*.
+	Annotation_MemberMode = "f5.io/member-mode"
+
+	// netPrefix is the name prefix of the static arps and routes managed by the controller,
+	// followed by the cluster name if set, see networkPrefix.
+	netPrefix = "k8s-"
+
+	// TenantLabel marks the AS3 tenants generated by the controller, for garbage collection.
+	TenantLabel = "bigip-kubernetes-gateway"
+
+	RouteMode_Static = "static"
+	RouteMode_BGP    = "bgp"
+
+	// retryBaseDelay and retryMaxDelay bound the backoff of retrying transient deploy failures.
+	retryBaseDelay = time.Second
+	retryMaxDelay  = 5 * time.Minute
+)
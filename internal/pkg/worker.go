@@ -0,0 +1,472 @@
+package pkg
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"math/rand"
+	"net/http"
+	"regexp"
+	"sort"
+	"sync"
+	"time"
+
+	f5_bigip "github.com/f5devcentral/f5-bigip-rest-go/bigip"
+	"github.com/f5devcentral/f5-bigip-rest-go/deployer"
+	"github.com/f5devcentral/f5-bigip-rest-go/utils"
+)
+
+// transientMessage matches the AS3 messages of busy BIG-IP, e.g. "Configuration operation in progress on device".
+var transientMessage = regexp.MustCompile(`(?i)busy|in progress|try again`)
+
+func newBIGIPWorker(bigip *f5_bigip.BIGIP) *bigipWorker {
+	w := &bigipWorker{
+		bigip:        bigip,
+		queue:        utils.NewDeployQueue(),
+		desired:      map[string]interface{}{},
+		applied:      map[string]string{},
+		appliedDecls: map[string]interface{}{},
+		as3Applied:   map[string]string{},
+		heal:         map[string]bool{},
+		catchup:      false,
+		failures:     map[string]string{},
+		retries:      0,
+		mutex:        sync.RWMutex{},
+	}
+	if bigip != nil {
+		w.as3 = newAS3Client(bigip.URL, bigip.Authorization)
+		w.as3.superseded = w.superseded
+	}
+	return w
+}
+
+// run handles the deploy requests until w.stopCh is closed.
+func (w *bigipWorker) run() {
+	defer w.stopRetry()
+	for {
+		select {
+		case <-w.stopCh:
+			return
+		default:
+			w.handleNext()
+		}
+	}
+}
+
+func (w *bigipWorker) handleNext() {
+	// block getting from queue
+	r := w.queue.Get().(deployer.DeployRequest)
+	if isWakeup(r) {
+		return
+	}
+	slog := utils.LogFromContext(r.Context)
+
+	// combine all requests from the queue
+	reqs := []deployer.DeployRequest{r}
+	l := w.queue.Len()
+	ids := []string{}
+	for i := 0; i < l; i++ {
+		m := w.queue.Get().(deployer.DeployRequest)
+		if isWakeup(m) {
+			continue
+		}
+		reqs = append(reqs, m)
+		ids = append(ids, utils.RequestIdFromContext(m.Context))
+	}
+	if len(ids) > 0 {
+		slog.Infof("merged requests %s for %s", ids, w.bigip.URL)
+	}
+
+	tenants := w.tenantsToDeploy(reqs)
+	if len(tenants) == 0 {
+		return
+	}
+	if dryRun != nil {
+		w.renderDesired(r, tenants)
+		return
+	}
+
+	// refuse to overwrite the tenants owned by others
+	results := w.verifyOwnership(tenants)
+	patched := map[string]bool{}
+	if MemberFastPath {
+		for k, err := range w.patchMembers(r.Context, tenants) {
+			results[k] = err
+			patched[k] = true
+		}
+	}
+
+	as3body := RestToAS3(map[string]interface{}{})
+	keys, deploying := []string{}, []string{}
+	for k, t := range tenants {
+		keys = append(keys, k)
+		// the ones with pool members updated already or refused are not submitted.
+		if _, f := results[k]; !f {
+			as3body["declaration"].(map[string]interface{})[k] = t
+			deploying = append(deploying, k)
+		}
+	}
+	if len(deploying) > 0 {
+		b, _ := json.Marshal(redactDeclaration(as3body))
+		slog.Debugf("Deployed AS3 to %s: %s", w.bigip.URL, string(b))
+		for k, err := range w.as3.deploy(r.Context, as3body, deploying) {
+			results[k] = err
+		}
+	}
+	errs := []error{}
+	for _, k := range keys {
+		if results[k] != nil {
+			errs = append(errs, fmt.Errorf("tenant %s: %s", k, results[k].Error()))
+		}
+	}
+	r.To = &as3body
+	DoneDeploys.Add(deployer.DeployResponse{
+		DeployRequest: r,
+		Status:        utils.MergeErrors(errs),
+	})
+
+	w.deployed(tenants, results, patched)
+	w.persist(r.Context)
+	reportProgrammedStatus(keys)
+}
+
+// verifyOwnership returns errors for the tenants existing on BIG-IP but owned by others,
+// only the ones not applied by the worker yet are checked.
+func (w *bigipWorker) verifyOwnership(tenants map[string]interface{}) map[string]error {
+	rlt := map[string]error{}
+	unverified := []string{}
+	w.mutex.RLock()
+	for k := range tenants {
+		if _, f := w.applied[k]; !f {
+			unverified = append(unverified, k)
+		}
+	}
+	w.mutex.RUnlock()
+	if len(unverified) == 0 {
+		return rlt
+	}
+
+	decl, err := w.as3.declaration()
+	if err != nil {
+		for _, k := range unverified {
+			rlt[k] = fmt.Errorf("failed to verify ownership on %s: %s", w.bigip.URL, err.Error())
+		}
+		return rlt
+	}
+	for _, k := range unverified {
+		if err := foreignTenant(k, decl[k]); err != nil {
+			rlt[k] = err
+		}
+	}
+	return rlt
+}
+
+// foreignTenant returns error if the existing tenant is not owned by this controller instance.
+func foreignTenant(name string, existing interface{}) error {
+	if !isTenant(existing) || ownedTenant(existing) {
+		return nil
+	}
+	tenant := existing.(map[string]interface{})
+	for _, app := range tenant {
+		if isApplication(app) {
+			return fmt.Errorf("tenant %s is owned by others, label: '%v', remark: '%v'", name, tenant["label"], tenant["remark"])
+		}
+	}
+	return nil
+}
+
+// superseded tells if all the given tenants are to be deployed again by the pending requests,
+// or by the next leader once the worker stops.
+func (w *bigipWorker) superseded(tenants []string) bool {
+	if w.stopped() {
+		return true
+	}
+	pending := map[string]bool{}
+	for _, item := range w.queue.Dumps() {
+		r := item.(deployer.DeployRequest)
+		if isWakeup(r) {
+			continue
+		}
+		for k, t := range (*r.To)["declaration"].(map[string]interface{}) {
+			if isTenant(t) {
+				pending[k] = true
+			}
+		}
+	}
+	for _, tn := range tenants {
+		if !pending[tn] {
+			return false
+		}
+	}
+	return true
+}
+
+// tenantsToDeploy records the tenants of the requests as desired, and returns the ones
+// not yet applied to the BIG-IP, including all desired tenants if a catch-up is needed.
+func (w *bigipWorker) tenantsToDeploy(reqs []deployer.DeployRequest) map[string]interface{} {
+	w.mutex.Lock()
+	defer w.mutex.Unlock()
+
+	tenants := map[string]interface{}{}
+	for _, r := range reqs {
+		for k, t := range (*r.To)["declaration"].(map[string]interface{}) {
+			if !isTenant(t) {
+				continue
+			}
+			w.desired[k] = t
+			tenants[k] = t
+		}
+	}
+	if w.catchup {
+		for k, t := range w.desired {
+			tenants[k] = t
+		}
+	}
+	for k := range w.heal {
+		if t, f := w.desired[k]; f {
+			tenants[k] = t
+		}
+		delete(w.applied, k)
+		delete(w.heal, k)
+	}
+
+	// eliminate duplicate requests
+	for k, t := range tenants {
+		if h, f := w.applied[k]; f && h == tenantHash(t) {
+			delete(tenants, k)
+		}
+	}
+	return tenants
+}
+
+// deployed updates the applied tenants to avoid duplicate requests if deployed successfully.
+// On transient errors, it forgets all the applied ones and retries with backoff, so that
+// a full catch-up is done on recovery. Permanent errors are kept for status reporting.
+// The patched tenants, whose pool members are updated over iControl REST, are re-deployed
+// via AS3 later, see syncLater.
+func (w *bigipWorker) deployed(tenants map[string]interface{}, results map[string]error, patched map[string]bool) {
+	w.mutex.Lock()
+	defer w.mutex.Unlock()
+
+	transient := false
+	for k, t := range tenants {
+		err := results[k]
+		switch {
+		case err == nil:
+			w.applied[k] = tenantHash(t)
+			w.appliedDecls[k] = t
+			if !patched[k] {
+				w.as3Applied[k] = w.applied[k]
+			}
+			delete(w.failures, k)
+		case err == errSuperseded:
+			delete(w.applied, k)
+			delete(w.appliedDecls, k)
+			delete(w.as3Applied, k)
+		case isTransient(err):
+			transient = true
+		default:
+			delete(w.applied, k)
+			delete(w.appliedDecls, k)
+			delete(w.as3Applied, k)
+			w.failures[k] = err.Error()
+		}
+	}
+
+	if transient {
+		w.applied = map[string]string{}
+		w.appliedDecls = map[string]interface{}{}
+		w.as3Applied = map[string]string{}
+		w.catchup = true
+		w.retryLater()
+	} else {
+		w.catchup = false
+		w.retries = 0
+	}
+	if len(w._unsynced()) > 0 {
+		w.syncLater()
+	}
+}
+
+// _unsynced returns the applied tenants whose declarations stored by AS3 are outdated.
+func (w *bigipWorker) _unsynced() []string {
+	rlt := []string{}
+	for k, h := range w.applied {
+		if w.as3Applied[k] != h {
+			rlt = append(rlt, k)
+		}
+	}
+	sort.Strings(rlt)
+	return rlt
+}
+
+// syncLater re-deploys the unsynced tenants via AS3 after as3SyncDelay, postponed by the further
+// member updates. The caller must hold w.mutex.
+func (w *bigipWorker) syncLater() {
+	if w.syncTimer != nil {
+		w.syncTimer.Stop()
+	}
+	w.syncTimer = time.AfterFunc(as3SyncDelay, func() {
+		w.mutex.RLock()
+		tenants := w._unsynced()
+		w.mutex.RUnlock()
+		if len(tenants) == 0 || w.stopped() {
+			return
+		}
+		ctx := NewContext()
+		utils.LogFromContext(ctx).Infof("re-deploying tenants %s via AS3 to %s after pool member updates", tenants, w.bigip.URL)
+		w.requestSelfHeal(ctx, tenants)
+	})
+}
+
+// retryLater triggers a deployment after the backoff delay, the caller must hold w.mutex.
+func (w *bigipWorker) retryLater() {
+	delay := backoff(w.retries)
+	w.retries++
+	if w.retryTimer != nil {
+		w.retryTimer.Stop()
+	}
+	w.retryTimer = time.AfterFunc(delay, func() {
+		ctx := NewContext()
+		utils.LogFromContext(ctx).Infof("retrying deployment to %s", w.bigip.URL)
+		as3 := RestToAS3(map[string]interface{}{})
+		w.queue.Add(deployer.DeployRequest{
+			To:      &as3,
+			AS3:     true,
+			Context: ctx,
+		})
+	})
+}
+
+// stopRetry cancels the scheduled retry and AS3 sync when the worker stops.
+func (w *bigipWorker) stopRetry() {
+	w.mutex.Lock()
+	defer w.mutex.Unlock()
+	if w.retryTimer != nil {
+		w.retryTimer.Stop()
+	}
+	if w.syncTimer != nil {
+		w.syncTimer.Stop()
+	}
+}
+
+func (w *bigipWorker) stopped() bool {
+	select {
+	case <-w.stopCh:
+		return true
+	default:
+		return false
+	}
+}
+
+// wakeup unblocks the queue getter to check if it's stopped, without anything to deploy.
+func wakeup(queue *utils.DeployQueue) {
+	queue.Insert(deployer.DeployRequest{})
+}
+
+func isWakeup(r deployer.DeployRequest) bool {
+	return r.To == nil
+}
+
+// failure returns the permanent error of the tenant failed to deploy, or "".
+func (w *bigipWorker) failure(tenant string) string {
+	w.mutex.RLock()
+	defer w.mutex.RUnlock()
+	return w.failures[tenant]
+}
+
+// backoff returns the exponential delay with jitter of the nth retry.
+func backoff(n int) time.Duration {
+	d := retryMaxDelay
+	if n < 32 && retryBaseDelay<<n < retryMaxDelay {
+		d = retryBaseDelay << n
+	}
+	return d/2 + time.Duration(rand.Int63n(int64(d/2)+1))
+}
+
+// isTransient tells if the deploy error may disappear by retrying, e.g. BIG-IP or AS3 is busy or unreachable.
+// The AS3 failures are told by their codes and messages only, 4xx ones are never transient.
+func isTransient(err error) bool {
+	var ae *as3Error
+	if errors.As(err, &ae) {
+		switch {
+		case ae.Code == http.StatusBadGateway || ae.Code == http.StatusServiceUnavailable || ae.Code == http.StatusGatewayTimeout:
+			return true
+		case ae.Code >= 400 && ae.Code < 500:
+			return false
+		default:
+			return transientMessage.MatchString(ae.Message)
+		}
+	}
+	return errors.Is(err, errTaskTimeout) || utils.NeedRetry(err)
+}
+
+// appliedTenants returns the desired tenants which are deployed to the BIG-IP successfully.
+func (w *bigipWorker) appliedTenants() map[string]interface{} {
+	w.mutex.RLock()
+	defer w.mutex.RUnlock()
+
+	rlt := map[string]interface{}{}
+	for k, t := range w.desired {
+		if h, f := w.applied[k]; f && h == tenantHash(t) {
+			rlt[k] = t
+		}
+	}
+	return rlt
+}
+
+// appliedHashes returns a copy of the hashes of the tenants applied via AS3, the ones updated over
+// iControl REST since are not included, so that they are re-deployed via AS3 after restart.
+func (w *bigipWorker) appliedHashes() map[string]string {
+	w.mutex.RLock()
+	defer w.mutex.RUnlock()
+
+	rlt := map[string]string{}
+	for k, h := range w.as3Applied {
+		rlt[k] = h
+	}
+	return rlt
+}
+
+// persist saves the hashes of the applied tenants, so that they are not re-deployed after restart.
+func (w *bigipWorker) persist(ctx context.Context) {
+	if appliedStore == nil {
+		return
+	}
+	if err := appliedStore.save(ctx, w.bigip.URL, w.appliedHashes()); err != nil {
+		utils.LogFromContext(ctx).Warnf("failed to persist applied tenants of %s: %s", w.bigip.URL, err.Error())
+	}
+}
+
+func tenantHash(t interface{}) string {
+	b, _ := json.Marshal(t)
+	return utils.MD5(b)
+}
+
+// requestSelfHeal asks the worker to re-apply the given tenants with the latest desired declarations.
+func (w *bigipWorker) requestSelfHeal(ctx context.Context, tenants []string) {
+	w.mutex.Lock()
+	for _, t := range tenants {
+		w.heal[t] = true
+	}
+	w.mutex.Unlock()
+
+	as3 := RestToAS3(map[string]interface{}{})
+	w.queue.Insert(deployer.DeployRequest{
+		To:      &as3,
+		AS3:     true,
+		Context: ctx,
+	})
+}
+
+func isTenant(t interface{}) bool {
+	tenant, ok := t.(map[string]interface{})
+	return ok && tenant["class"] == "Tenant"
+}
+
+func workers() []*bigipWorker {
+	workersMutex.RLock()
+	defer workersMutex.RUnlock()
+	return deployWorkers
+}
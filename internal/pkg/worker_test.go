@@ -0,0 +1,117 @@
+package pkg
+
+import (
+	"fmt"
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/f5devcentral/f5-bigip-rest-go/deployer"
+	"github.com/f5devcentral/f5-bigip-rest-go/utils"
+)
+
+func Test_bigipWorker_tenantsToDeploy(t *testing.T) {
+	request := func(tenants ...string) deployer.DeployRequest {
+		cfgs := map[string]interface{}{}
+		for _, tn := range tenants {
+			cfgs[tn] = map[string]interface{}{"serviceMain": map[string]interface{}{}}
+		}
+		as3 := RestToAS3(cfgs)
+		return deployer.DeployRequest{To: &as3, AS3: true}
+	}
+	results := func(tenants map[string]interface{}, err error) map[string]error {
+		rlt := map[string]error{}
+		for k := range tenants {
+			rlt[k] = err
+		}
+		return rlt
+	}
+	keys := func(m map[string]interface{}) map[string]bool {
+		rlt := map[string]bool{}
+		for k := range m {
+			rlt[k] = true
+		}
+		return rlt
+	}
+
+	w := newBIGIPWorker(nil)
+	tenants := w.tenantsToDeploy([]deployer.DeployRequest{request("a"), request("b")})
+	if !reflect.DeepEqual(keys(tenants), map[string]bool{"a": true, "b": true}) {
+		t.Fatalf("unexpected tenants: %v", tenants)
+	}
+	w.deployed(tenants, results(tenants, nil), nil)
+
+	// applied tenants are skipped
+	if tenants := w.tenantsToDeploy([]deployer.DeployRequest{request("a")}); len(tenants) != 0 {
+		t.Errorf("expected no tenant to deploy, got %v", tenants)
+	}
+
+	// a permanent failure is kept for the tenant only
+	tenants = w.tenantsToDeploy([]deployer.DeployRequest{request("c")})
+	w.deployed(tenants, results(tenants, &as3Error{Code: 422, Message: "declaration is invalid"}), nil)
+	if w.catchup || w.failure("c") == "" || w.failure("a") != "" {
+		t.Errorf("unexpected states after permanent failure: %v", w.failures)
+	}
+
+	// a transient failure leads to a catch-up of all desired tenants
+	tenants = w.tenantsToDeploy([]deployer.DeployRequest{request("c")})
+	w.deployed(tenants, results(tenants, &as3Error{Code: 503, Message: "busy"}), nil)
+	w.retryTimer.Stop()
+	if w.retries != 1 {
+		t.Errorf("expected 1 retry scheduled, got %d", w.retries)
+	}
+	tenants = w.tenantsToDeploy([]deployer.DeployRequest{request()})
+	if !reflect.DeepEqual(keys(tenants), map[string]bool{"a": true, "b": true, "c": true}) {
+		t.Errorf("expected catch-up of all tenants, got %v", tenants)
+	}
+	w.deployed(tenants, results(tenants, nil), nil)
+	if tenants := w.tenantsToDeploy([]deployer.DeployRequest{request()}); len(tenants) != 0 {
+		t.Errorf("expected no tenant to deploy after recovery, got %v", tenants)
+	}
+	if w.retries != 0 || w.failure("c") != "" {
+		t.Errorf("expected states reset after recovery, retries: %d, failures: %v", w.retries, w.failures)
+	}
+
+	// drifted tenants are re-applied
+	w.heal["b"] = true
+	tenants = w.tenantsToDeploy([]deployer.DeployRequest{request()})
+	if !reflect.DeepEqual(keys(tenants), map[string]bool{"b": true}) {
+		t.Errorf("expected tenant b to re-apply, got %v", tenants)
+	}
+}
+
+func Test_backoff(t *testing.T) {
+	for n, max := range map[int]time.Duration{
+		0:   retryBaseDelay,
+		3:   8 * retryBaseDelay,
+		20:  retryMaxDelay,
+		100: retryMaxDelay,
+	} {
+		if d := backoff(n); d < max/2 || d > max {
+			t.Errorf("backoff(%d) = %s, expected in [%s, %s]", n, d, max/2, max)
+		}
+	}
+}
+
+func Test_isTransient(t *testing.T) {
+	wrap := func(err error) error { return fmt.Errorf("failed to do deployment to https://bigip: %w", err) }
+	for name, c := range map[string]struct {
+		err       error
+		transient bool
+	}{
+		"busy":        {wrap(&as3Error{Code: 503, Message: "Configuration operation in progress on device"}), true},
+		"gateway":     {wrap(&as3Error{Code: 504, Message: "Gateway Timeout"}), true},
+		"in progress": {wrap(&as3Error{Code: 0, Message: "in progress"}), true},
+		"unreachable": {wrap(utils.RetryErrorf("dial tcp: connection refused")), true},
+		"task":        {fmt.Errorf("AS3 task 1 on https://bigip %w after 5m", errTaskTimeout), true},
+		// the declaration echoed in the detail of the invalid declaration doesn't matter.
+		"invalid": {wrap(&as3Error{Code: 422, Message: "declaration is invalid",
+			detail: `/serviceMain/timeout-busy: "in progress, try again" is not valid`}), false},
+		"failed":  {wrap(&as3Error{Code: 500, Message: "declaration failed", detail: "busy timeout"}), false},
+		"unknown": {fmt.Errorf("request timeout"), false},
+	} {
+		if isTransient(c.err) != c.transient {
+			t.Errorf("%s: isTransient(%s) expected %t", name, c.err, c.transient)
+		}
+	}
+}